@@ -5,11 +5,13 @@ go 1.23.0
 toolchain go1.24.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/Data-Corruption/rlog v1.3.0
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/minio/sha256-simd v1.0.1
 	github.com/yuin/goldmark v1.7.11
 	golang.org/x/net v0.40.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
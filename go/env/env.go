@@ -8,6 +8,13 @@ const (
 	IM_ASSET_CACHE_MB = "IM_ASSET_CACHE_MB"
 	IM_LOG_LEVEL      = "IM_LOG_LEVEL"
 	IM_UPDATE_SECRET  = "IM_UPDATE_SECRET"
+	IM_BASE_URL       = "IM_BASE_URL" // e.g. "https://intermark.dev", used for canonical and og: urls
+	IM_GIT_REMOTE     = "IM_GIT_REMOTE"
+	IM_GIT_BRANCH     = "IM_GIT_BRANCH"
+	IM_POLL_M         = "IM_POLL_M"    // minutes between remote polls, 0 disables
+	IM_ROBOTS         = "IM_ROBOTS"    // "allow" or "disallow", ignored if public/.robots.txt exists
+	IM_LUNR_NODE      = "IM_LUNR_NODE" // "true" builds the search index with node instead of in process
+	IM_UPLOAD_MB      = "IM_UPLOAD_MB" // largest asset upload request in edit mode
 
 	// Timeouts in minutes
 
@@ -23,6 +30,13 @@ var defaults = map[string]string{
 	IM_ASSET_CACHE_MB: "1024", // 1GB
 	IM_LOG_LEVEL:      "warn",
 	IM_UPDATE_SECRET:  "",
+	IM_BASE_URL:       "",
+	IM_GIT_REMOTE:     "origin",
+	IM_GIT_BRANCH:     "main",
+	IM_POLL_M:         "0",
+	IM_ROBOTS:         "allow",
+	IM_LUNR_NODE:      "false",
+	IM_UPLOAD_MB:      "100",
 	IM_GIT_M:          "5",
 	IM_LFS_M:          "5",
 	IM_TAIL_M:         "1",
@@ -89,7 +89,7 @@ func (l *LRU) Read(path string) ([]byte, string, bool, error) {
 
 	// compress
 	zipped := false
-	if l.gzip && shouldGzip(mime) {
+	if l.gzip && ShouldGzip(mime) {
 		zipped = true
 		var b bytes.Buffer
 		gz := gzip.NewWriter(&b)
@@ -186,7 +186,8 @@ var gzipUnsafeMIMEs = map[string]bool{
 	"application/x-gzip": true,
 }
 
-func shouldGzip(mime string) bool {
+// ShouldGzip reports whether content of the given mime type benefits from gzip.
+func ShouldGzip(mime string) bool {
 	if gzipUnsafeMIMEs[mime] {
 		return false
 	}
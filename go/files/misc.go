@@ -1,10 +1,12 @@
 package files
 
 import (
+	"fmt"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -93,3 +95,77 @@ func DetectMimeType(path string, data []byte) string {
 	}
 	return http.DetectContentType(data) // fallback
 }
+
+// WriteAtomic writes data to a temp file next to path and renames it over path,
+// so readers see the old or new content, never a partial write. An existing
+// file keeps its permissions, otherwise perms is used.
+func WriteAtomic(path string, data []byte, perms os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perms = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temp file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), perms); err != nil {
+		return fmt.Errorf("error setting temp file permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Within reports whether path is inside dir, after making both absolute and
+// resolving symlinks. path doesn't have to exist, its nearest existing parent is resolved.
+func Within(dir, path string) (bool, error) {
+	d, err := resolvePath(dir)
+	if err != nil {
+		return false, err
+	}
+	p, err := resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(d, p)
+	if err != nil {
+		return false, nil
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// resolvePath is filepath.EvalSymlinks for paths that may not exist yet.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for {
+		real, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return filepath.Join(abs, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(abs), rest)
+		abs = parent
+	}
+}
@@ -3,6 +3,7 @@ package flags
 import (
 	"os"
 	"slices"
+	"strings"
 )
 
 func Present(arg string) bool {
@@ -17,3 +18,12 @@ func PresentAny(args ...string) bool {
 	}
 	return false
 }
+
+// Value returns the argument following arg, if present and not itself a flag.
+func Value(arg string) (string, bool) {
+	i := slices.Index(os.Args, arg)
+	if i < 0 || i+1 >= len(os.Args) || strings.HasPrefix(os.Args[i+1], "-") {
+		return "", false
+	}
+	return os.Args[i+1], true
+}
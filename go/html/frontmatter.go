@@ -0,0 +1,180 @@
+package html
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FrontMatter is the optional metadata block at the top of a page, either
+// YAML fenced by `---` lines or TOML fenced by `+++` lines.
+type FrontMatter struct {
+	Title       string
+	Description string
+	Label       string // sidebar label
+	Position    int    // sidebar position
+	Template    string
+	Icon        string         // raw HTML
+	Draft       bool           // not built in prod
+	Hidden      bool           // built, but not shown in the sidebar
+	Date        time.Time      // publish date, used by feeds
+	Aliases     []string       // old URLs that redirect here
+	Tags        []string       // search facets
+	Params      map[string]any // everything else
+}
+
+// SplitFrontMatter separates front matter from the rest of the data.
+// If there is none, it returns an empty FrontMatter and the data as is.
+func SplitFrontMatter(data []byte) (*FrontMatter, []byte, error) {
+	fm := &FrontMatter{Params: map[string]any{}}
+
+	// find fences
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // BOM
+	var fence []byte
+	switch {
+	case bytes.HasPrefix(data, []byte("---\n")), bytes.HasPrefix(data, []byte("---\r\n")):
+		fence = []byte("---")
+	case bytes.HasPrefix(data, []byte("+++\n")), bytes.HasPrefix(data, []byte("+++\r\n")):
+		fence = []byte("+++")
+	default:
+		return fm, data, nil
+	}
+	start := bytes.IndexByte(data, '\n') + 1
+	end, rest := -1, len(data)
+	for i := start; i < len(data); {
+		lineEnd := bytes.IndexByte(data[i:], '\n')
+		next := len(data)
+		if lineEnd >= 0 {
+			next = i + lineEnd + 1
+		}
+		if bytes.Equal(bytes.TrimRight(data[i:next], "\r\n"), fence) {
+			end, rest = i, next
+			break
+		}
+		i = next
+	}
+	if end < 0 {
+		return nil, nil, fmt.Errorf("unterminated front matter, missing closing %s", fence)
+	}
+
+	// decode
+	raw := map[string]any{}
+	if fence[0] == '-' {
+		if err := yaml.Unmarshal(data[start:end], &raw); err != nil {
+			return nil, nil, fmt.Errorf("error parsing YAML front matter: %w", err)
+		}
+	} else {
+		if err := toml.Unmarshal(data[start:end], &raw); err != nil {
+			return nil, nil, fmt.Errorf("error parsing TOML front matter: %w", err)
+		}
+	}
+
+	// pull out known keys, keep the rest as params
+	for k, v := range raw {
+		var ok bool
+		switch k {
+		case "title":
+			fm.Title, ok = scalarString(v)
+		case "description":
+			fm.Description, ok = scalarString(v)
+		case "label":
+			fm.Label, ok = scalarString(v)
+		case "template":
+			fm.Template, ok = v.(string)
+		case "icon":
+			fm.Icon, ok = v.(string)
+		case "draft":
+			fm.Draft, ok = v.(bool)
+		case "hidden":
+			fm.Hidden, ok = v.(bool)
+		case "aliases":
+			fm.Aliases, ok = stringList(v)
+		case "tags":
+			fm.Tags, ok = stringList(v)
+		case "date":
+			fm.Date, ok = parseDate(v)
+		case "position":
+			switch n := v.(type) {
+			case int:
+				fm.Position, ok = n, true
+			case int64:
+				fm.Position, ok = int(n), true
+			}
+		default:
+			fm.Params[k], ok = v, true
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("front matter key %q has the wrong type", k)
+		}
+	}
+
+	return fm, data[rest:], nil
+}
+
+// scalarString accepts any scalar as text, so `title: 1.0` or `label: true`
+// don't fail the whole layout update.
+func scalarString(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), true
+	case time.Time:
+		if s.Hour() == 0 && s.Minute() == 0 && s.Second() == 0 && s.Nanosecond() == 0 {
+			return s.Format("2006-01-02"), true
+		}
+		return s.Format(time.RFC3339), true
+	case int, int64, uint64, bool:
+		return fmt.Sprint(s), true
+	}
+	return "", false
+}
+
+// stringList accepts a list of strings or a single string.
+func stringList(v any) ([]string, bool) {
+	switch l := v.(type) {
+	case string:
+		return []string{l}, true
+	case []any:
+		out := make([]string, 0, len(l))
+		for _, item := range l {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// parseDate accepts YAML / TOML dates and datetimes, or a string in either form.
+func parseDate(v any) (time.Time, bool) {
+	switch d := v.(type) {
+	case time.Time:
+		return d, true
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, d); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// ReadFrontMatter reads just the front matter of the file at path.
+func ReadFrontMatter(path string) (*FrontMatter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fm, _, err := SplitFrontMatter(data)
+	return fm, err
+}
@@ -31,13 +31,25 @@ func init() {
 	)
 }
 
-// FromFile reads a file from the given path, converts it from Markdown to HTML if it's a Markdown file,
-// and adds IDs to headers if missing.
+// FromFile reads a file from the given path, strips any front matter, converts it from Markdown
+// to HTML if it's a Markdown file, and adds IDs to headers if missing.
 func FromFile(path string, tmplData map[string]any) ([]byte, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	return FromData(path, data, tmplData)
+}
+
+// FromData is FromFile for content that isn't saved, e.g. an editor preview.
+// path's extension picks Markdown or HTML and it's used in errors.
+func FromData(path string, data []byte, tmplData map[string]any) ([]byte, error) {
+	var err error
+
+	// strip front matter, see ReadFrontMatter
+	if _, data, err = SplitFrontMatter(data); err != nil {
+		return nil, fmt.Errorf("error reading front matter from file %s: %w", path, err)
+	}
 
 	// extract raw blocks if present
 	dataStr, raws, err := extractRawBlocks(string(data))
@@ -90,6 +102,81 @@ func FromMarkdown(md []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// Summary returns the text of the first h1 and first paragraph in the given HTML,
+// used as fallbacks for a page's title and description. The paragraph is capped at maxDesc runes.
+func Summary(data []byte, maxDesc int) (string, string, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", "", err
+	}
+	var title, desc string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "h1":
+				if title == "" {
+					title = strings.Join(strings.Fields(getTextContent(n)), " ")
+				}
+				return
+			case "p":
+				if desc == "" {
+					desc = strings.Join(strings.Fields(getTextContent(n)), " ")
+				}
+				return
+			case "script", "style":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil && (title == "" || desc == ""); c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	if r := []rune(desc); len(r) > maxDesc {
+		desc = strings.TrimSpace(string(r[:maxDesc-1])) + "…"
+	}
+	return title, desc, nil
+}
+
+// ContentHTML returns the inner HTML of the `_content` element of a rendered page, used for feeds.
+// Scripts are dropped and root relative href / src attributes are made absolute with base.
+func ContentHTML(data []byte, base string) (string, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	content := getElementById(root, "_content")
+	if content == nil {
+		return "", fmt.Errorf("no element with id '_content' found")
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && c.Data == "script" {
+				n.RemoveChild(c)
+			} else {
+				for i, a := range c.Attr {
+					if (a.Key == "href" || a.Key == "src") && strings.HasPrefix(a.Val, "/") && !strings.HasPrefix(a.Val, "//") {
+						c.Attr[i].Val = base + a.Val
+					}
+				}
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(content)
+	var buf bytes.Buffer
+	for c := content.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
 // idHeaders adds IDs to headers in a Markdown document.
 func idHeaders(data []byte) ([]byte, error) {
 	root, err := html.Parse(bytes.NewReader(data))
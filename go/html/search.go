@@ -13,14 +13,21 @@ import (
 
 // Doc is the halfway point between HTML and lunrjs index.
 type Doc struct {
-	ID    string `json:"id"`    // relpath + frag
-	URL   string `json:"url"`   // /p/ + relpath + frag
-	Title string `json:"title"` // Header text
-	Body  string `json:"body"`  // All text content until next header
+	ID           string   `json:"id"`                     // relpath + frag
+	URL          string   `json:"url"`                    // /p/ + relpath + frag
+	Title        string   `json:"title"`                  // Header text
+	Body         string   `json:"body"`                   // All text content until next header
+	Section      string   `json:"section,omitempty"`      // top level sidebar folder path, e.g. "api"
+	SectionLabel string   `json:"sectionLabel,omitempty"` // its sidebar label
+	Tags         []string `json:"tags,omitempty"`         // page's front matter tags
+	Page         string   `json:"page,omitempty"`         // page title
+	Breadcrumb   []string `json:"breadcrumb,omitempty"`   // page title, then enclosing headings down to this one
+	Level        int      `json:"level"`                  // 1-6 for h1-h6
 }
 
-// ExtractDocs, data in, docs out. Logs if given a logger.
-func ExtractDocs(relpath string, data []byte, docs *[]Doc, log *logger.Logger) error {
+// ExtractDocs, data in, docs out. pageTitle starts each breadcrumb, it's
+// passed in since templates don't have to put it in the page. Logs if given a logger.
+func ExtractDocs(relpath, pageTitle string, data []byte, docs *[]Doc, log *logger.Logger) error {
 	doc, err := html.Parse(bytes.NewReader(data))
 	if err != nil {
 		panic(err)
@@ -29,10 +36,37 @@ func ExtractDocs(relpath string, data []byte, docs *[]Doc, log *logger.Logger) e
 	if content == nil {
 		return errors.New("no element with id '_content' found")
 	}
+	first := len(*docs)
 	extractDocsTraverse(content, relpath, docs, log)
+	setBreadcrumbs((*docs)[first:], pageTitle)
 	return nil
 }
 
+// setBreadcrumbs sets the page title and breadcrumb of a page's docs, e.g.
+// "Deployment › Setup NGINX › Create Site Configuration". A heading repeating
+// the crumb before it, like an h1 matching the page title, is left out.
+func setBreadcrumbs(docs []Doc, pageTitle string) {
+	var parents [7]string // latest heading text by level
+	for i := range docs {
+		d := &docs[i]
+		d.Page = pageTitle
+		parents[d.Level] = strings.Join(strings.Fields(d.Title), " ")
+		for l := d.Level + 1; l < len(parents); l++ {
+			parents[l] = ""
+		}
+		crumbs := []string{}
+		if pageTitle != "" {
+			crumbs = append(crumbs, pageTitle)
+		}
+		for l := 1; l <= d.Level; l++ {
+			if parents[l] != "" && (len(crumbs) == 0 || crumbs[len(crumbs)-1] != parents[l]) {
+				crumbs = append(crumbs, parents[l])
+			}
+		}
+		d.Breadcrumb = crumbs
+	}
+}
+
 func extractDocsTraverse(n *html.Node, relpath string, docs *[]Doc, log *logger.Logger) {
 	if hasAttr(n, "data-nosearch") || hasAttr(n.Parent, "data-nosearch") {
 		return
@@ -56,6 +90,7 @@ func extractDocsTraverse(n *html.Node, relpath string, docs *[]Doc, log *logger.
 				URL:   url,
 				Title: getTextContent(n),
 				Body:  "",
+				Level: int(n.Data[1] - '0'),
 			}
 			*docs = append(*docs, doc)
 			if log != nil {
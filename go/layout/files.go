@@ -0,0 +1,201 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"intermark/go/files"
+	"intermark/go/paths"
+)
+
+// Filesystem changes from the edit UI. Paths are relative to PUB_DIR with
+// forward slashes, like SidebarItem.Path. Each one updates the layout after.
+
+var (
+	ErrInvalidPath = errors.New("invalid path")
+	ErrExists      = errors.New("already exists")
+	ErrNotEmpty    = errors.New("folder is not empty")
+)
+
+// pubPath checks rel names a visible, URL safe page (if page) or folder in
+// PUB_DIR, and returns its filesystem path.
+func pubPath(rel string, page bool) (string, error) {
+	if rel == "" || path.Clean(rel) != rel || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, rel)
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") || !isURLSafePath(part) {
+			return "", fmt.Errorf("%w: %q, names can't start with a dot and must be URL safe", ErrInvalidPath, rel)
+		}
+	}
+	if page && !isPage(rel) {
+		return "", fmt.Errorf("%w: %q, pages end in .md or .html", ErrInvalidPath, rel)
+	}
+	full := filepath.Join(paths.PUB_DIR, filepath.FromSlash(rel))
+	if in, err := files.Within(paths.PUB_DIR, full); err != nil {
+		return "", err
+	} else if !in {
+		return "", fmt.Errorf("%w: %q is outside %s", ErrInvalidPath, rel, paths.PUB_DIR)
+	}
+	return full, nil
+}
+
+// CreatePage creates a page at rel with a heading from its name, and any missing folders.
+func (l *Layout) CreatePage(ctx context.Context, rel string) error {
+	full, err := pubPath(rel, true)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return fmt.Errorf("error creating folders for %s: %w", rel, err)
+	}
+	f, err := os.OpenFile(full, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s", ErrExists, rel)
+		}
+		return fmt.Errorf("error creating page %s: %w", rel, err)
+	}
+	title := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	content := "# " + title + "\n"
+	if path.Ext(rel) == ".html" {
+		content = "<h1>" + title + "</h1>\n"
+	}
+	_, err = f.WriteString(content)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing page %s: %w", rel, err)
+	}
+	return l.Update(ctx)
+}
+
+// CreateFolder creates a folder at rel, and any missing parents.
+func (l *Layout) CreateFolder(ctx context.Context, rel string) error {
+	full, err := pubPath(rel, false)
+	if err != nil {
+		return err
+	}
+	if exists, err := files.Exists(full); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrExists, rel)
+	}
+	if err := os.MkdirAll(full, 0o755); err != nil {
+		return fmt.Errorf("error creating folder %s: %w", rel, err)
+	}
+	return l.Update(ctx)
+}
+
+// Move renames or moves the page or folder at from to to. Sidebar settings
+// follow it, labels too unless they were just the old name. If redirect is
+// set, the old URLs of moved pages are added to the hand written redirects.
+func (l *Layout) Move(ctx context.Context, from, to string, redirect bool) error {
+	fromFull, err := pubPath(from, false)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(fromFull)
+	if err != nil {
+		return err
+	}
+	toFull, err := pubPath(to, !info.IsDir() && isPage(from))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && strings.HasPrefix(to+"/", from+"/") {
+		return fmt.Errorf("%w: can't move %s into itself", ErrInvalidPath, from)
+	}
+	if exists, err := files.Exists(toFull); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrExists, to)
+	}
+
+	// old page URLs, collected before the move
+	var moved []string
+	if redirect {
+		err := filepath.WalkDir(fromFull, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(paths.PUB_DIR, p)
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isPage(rel) {
+				moved = append(moved, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error listing pages in %s: %w", from, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(toFull), 0o755); err != nil {
+		return fmt.Errorf("error creating folders for %s: %w", to, err)
+	}
+	if err := os.Rename(fromFull, toFull); err != nil {
+		return fmt.Errorf("error moving %s to %s: %w", from, to, err)
+	}
+
+	// point items at the new paths so Update keeps their settings
+	l.Walk(func(si *SidebarItem) (bool, error) {
+		if si.Path != from && !strings.HasPrefix(si.Path, from+"/") {
+			return false, nil
+		}
+		old := si.Path
+		si.Path = to + strings.TrimPrefix(si.Path, from)
+		if (si.Type == "file" || si.Type == "folder") && si.Label == path.Base(old) {
+			si.Label = path.Base(si.Path)
+		}
+		return false, nil
+	})
+
+	if len(moved) > 0 {
+		rd, err := LoadRedirects(paths.REDIRECTS)
+		if err != nil {
+			return fmt.Errorf("error loading redirects: %w", err)
+		}
+		for _, old := range moved {
+			rd.Add(fileURL(old), fileURL(to+strings.TrimPrefix(old, from)))
+		}
+		if err := rd.Save(paths.REDIRECTS); err != nil {
+			return fmt.Errorf("error saving redirects: %w", err)
+		}
+	}
+	return l.Update(ctx)
+}
+
+// Delete removes the page or empty folder at rel.
+func (l *Layout) Delete(ctx context.Context, rel string) error {
+	full, err := pubPath(rel, false)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(full)
+		if err != nil {
+			return fmt.Errorf("error reading folder %s: %w", rel, err)
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("%w: %s", ErrNotEmpty, rel)
+		}
+	}
+	if err := os.Remove(full); err != nil {
+		return fmt.Errorf("error deleting %s: %w", rel, err)
+	}
+	return l.Update(ctx)
+}
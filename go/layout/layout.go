@@ -2,6 +2,7 @@ package layout
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -21,6 +22,7 @@ import (
 	"intermark/go/themes"
 
 	"github.com/Data-Corruption/rlog/logger"
+	"github.com/minio/sha256-simd"
 )
 
 var ErrItemNotFound = fmt.Errorf("item not found")
@@ -44,6 +46,12 @@ type Layout struct {
 	IconHref string        `json:"-"` // href to the icon, e.g., "/assets/logo.svg"
 	IconType string        `json:"-"` // mime type of the icon
 	Footer   template.HTML `json:"-"` // footer content, if any
+
+	// Redirects is the saved redirect table plus front matter aliases.
+	Redirects Redirects `json:"-"`
+
+	// Version is a hash of the saved layout.json, used by the edit UI to detect stale writes.
+	Version string `json:"-"`
 }
 
 func (l *Layout) FromFile(ctx context.Context) error {
@@ -116,6 +124,25 @@ func (l *Layout) Update(ctx context.Context) error {
 		return false, nil
 	})
 
+	// load redirects, hand written ones win over detected renames. Also used
+	// to carry settings over to renamed files
+	redirects, err := LoadRedirects(paths.RENAMES)
+	if err != nil {
+		return fmt.Errorf("error loading renames: %w", err)
+	}
+	manual, err := LoadRedirects(paths.REDIRECTS)
+	if err != nil {
+		return fmt.Errorf("error loading redirects: %w", err)
+	}
+	for from, to := range manual {
+		redirects[NormalizeURL(from)] = NormalizeURL(to)
+	}
+	movedFrom := map[string][]string{} // "/p/new" -> ["/p/old"]
+	for from, to := range redirects {
+		movedFrom[to] = append(movedFrom[to], from)
+	}
+	aliases := map[string]string{} // "/p/alias" -> "/p/page"
+
 	// tree nodes map: path -> pointer to SidebarItem
 	tree := make(map[string]*SidebarItem)
 	// virtual root
@@ -123,7 +150,7 @@ func (l *Layout) Update(ctx context.Context) error {
 	tree[""] = root
 
 	// walk filesystem
-	err := filepath.WalkDir(paths.PUB_DIR, func(path string, d fs.DirEntry, err error) error {
+	err = filepath.WalkDir(paths.PUB_DIR, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -155,7 +182,16 @@ func (l *Layout) Update(ctx context.Context) error {
 			if _, exists := tree[cur]; !exists {
 				t := sins.Ternary(d.IsDir() || i < len(parts)-1, "folder", "file") // if dir or we are not at the last part yet
 				node := &SidebarItem{Type: t, Path: cur, Label: name, Template: "page-nav-side-toc.html", Children: nonFsTypeMap[cur]}
-				if o := fsTypeMap[cur]; o != nil {
+				o := fsTypeMap[cur]
+				if o == nil && t == "file" { // renamed, use the old item's settings if it's still around
+					for _, old := range movedFrom[fileURL(cur)] {
+						if o = fsTypeMap[strings.TrimPrefix(old, "/p/")+filepath.Ext(cur)]; o != nil {
+							break
+						}
+					}
+				}
+				if o != nil {
+					o = o.Saved() // not front matter from the last update
 					node.Label = o.Label
 					node.Bold = o.Bold
 					node.Link = o.Link
@@ -164,10 +200,19 @@ func (l *Layout) Update(ctx context.Context) error {
 					node.Position = o.Position
 					node.Collapsed = o.Collapsed
 					node.DisableCollapse = o.DisableCollapse
+					node.Feed = o.Feed
 				}
-				// if node is a file, set link to cur - ext
+				// if node is a file, set link to cur - ext and merge front matter
 				if node.Type == "file" {
 					node.Link = "/p/" + strings.TrimSuffix(node.Path, filepath.Ext(node.Path))
+					fm, err := html.ReadFrontMatter(path)
+					if err != nil {
+						return fmt.Errorf("error reading front matter %s: %w", cur, err)
+					}
+					node.applyFrontMatter(fm)
+					for _, alias := range fm.Aliases {
+						aliases[NormalizeURL(alias)] = node.Link
+					}
 				}
 				tree[cur] = node
 				tree[parent].Children = append(tree[parent].Children, node)
@@ -225,6 +270,12 @@ func (l *Layout) Update(ctx context.Context) error {
 		logger.Debugf(ctx, "Post Update Layout:\n\n%s\n", l.Debug())
 	}
 
+	// aliases win, they live next to the content
+	for from, to := range aliases {
+		redirects[from] = to
+	}
+	l.Redirects = redirects
+
 	// load icon
 	iconPath, found := files.FirstExists(paths.ASS_DIR, "icon.ico", "icon.svg", "icon.png", "icon.jpg", "icon.jpeg", "icon.avif")
 	iconExt := filepath.Ext(iconPath)
@@ -270,7 +321,39 @@ func (l *Layout) Update(ctx context.Context) error {
 		l.Title, len(l.InlineIcon), l.IndexTmpl, len(l.Sidebar), l.IconHref, l.IconType, len(l.Footer),
 	)
 
-	return files.SaveJSON(paths.LAYOUT, l, 0o644)
+	// save
+	data, err := l.ToJSON()
+	if err != nil {
+		return fmt.Errorf("error encoding layout: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	l.Version = hex.EncodeToString(sum[:8])
+	if err := files.WriteAtomic(paths.LAYOUT, data, 0o644); err != nil {
+		return fmt.Errorf("error writing layout file: %w", err)
+	}
+	return nil
+}
+
+// Feeds returns the folders flagged as feed sources.
+func (l *Layout) Feeds() []*SidebarItem {
+	feeds := []*SidebarItem{}
+	l.Walk(func(si *SidebarItem) (bool, error) {
+		if si.Type == "folder" && si.Feed {
+			feeds = append(feeds, si)
+		}
+		return false, nil
+	})
+	return feeds
+}
+
+// Section returns the top level sidebar folder containing path, nil if there isn't one.
+func (l *Layout) Section(path string) *SidebarItem {
+	for _, si := range l.Sidebar {
+		if si.Type == "folder" && strings.HasPrefix(path, si.Path+"/") {
+			return si
+		}
+	}
+	return nil
 }
 
 // helper func for recursing through the sidebar, exiting if f returns true or an error
@@ -0,0 +1,96 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"intermark/go/files"
+)
+
+const maxRedirectHops = 10 // guards against loops in the table
+
+// Redirects maps old URLs to where the content lives now, e.g. "/p/old" -> "/p/new".
+// Kept in paths.REDIRECTS (by hand) and paths.RENAMES (detected from git), and
+// merged with front matter aliases by Update.
+type Redirects map[string]string
+
+// LoadRedirects loads a redirect table, an empty one if it doesn't exist yet.
+func LoadRedirects(path string) (Redirects, error) {
+	rd := Redirects{}
+	if err := files.LoadJSON(path, &rd); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// Save writes the redirect table to path.
+func (rd Redirects) Save(path string) error {
+	return files.SaveJSON(path, rd, 0o644)
+}
+
+// Add adds a redirect and points existing redirects to from at to, so chains
+// stay one hop. Redirects to themselves are dropped.
+func (rd Redirects) Add(from, to string) {
+	from, to = NormalizeURL(from), NormalizeURL(to)
+	if from == to {
+		return
+	}
+	for k, v := range rd {
+		if v == from {
+			rd[k] = to
+		}
+	}
+	rd[from] = to
+	delete(rd, to) // the target exists again, don't redirect away from it
+}
+
+// AddRenames adds redirects for renamed files, given as paths relative to
+// PUB_DIR, e.g. "old.md" -> "usage/new.md". Non page files are ignored.
+func (rd Redirects) AddRenames(renames map[string]string) {
+	for from, to := range renames {
+		if isPage(from) && isPage(to) {
+			rd.Add(fileURL(from), fileURL(to))
+		}
+	}
+}
+
+// Resolve returns where path redirects to, following chains.
+func (rd Redirects) Resolve(path string) (string, bool) {
+	cur, found := NormalizeURL(path), false
+	for range maxRedirectHops {
+		next, ok := rd[cur]
+		if !ok {
+			break
+		}
+		cur, found = next, true
+	}
+	return cur, found
+}
+
+// NormalizeURL turns an alias or request path into a redirect table key.
+// Relative aliases are under /p/, e.g. "old" -> "/p/old", and trailing
+// slashes and page extensions are dropped.
+func NormalizeURL(u string) string {
+	if !strings.HasPrefix(u, "/") && !strings.Contains(u, "://") {
+		u = "/p/" + u
+	}
+	if u != "/" {
+		u = strings.TrimSuffix(u, "/")
+	}
+	if strings.HasPrefix(u, "/p/") {
+		u = strings.TrimSuffix(strings.TrimSuffix(u, ".md"), ".html")
+	}
+	return u
+}
+
+func isPage(path string) bool {
+	ext := filepath.Ext(path)
+	return (ext == ".md" || ext == ".html") && !strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// fileURL returns the URL of a page given its path relative to PUB_DIR.
+func fileURL(rel string) string {
+	rel = filepath.ToSlash(rel)
+	return "/p/" + strings.TrimSuffix(rel, filepath.Ext(rel))
+}
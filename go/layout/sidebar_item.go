@@ -2,14 +2,18 @@ package layout
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"os"
 	"path/filepath"
 	"strings"
 
+	"intermark/go/env"
 	"intermark/go/flags"
 	"intermark/go/html"
 	"intermark/go/paths"
+	"intermark/go/sins"
 	"intermark/go/stringsx"
 	"intermark/go/themes"
 )
@@ -37,6 +41,9 @@ type SidebarItem struct {
 	// Folder Only: whether the folder should not be collapsible.
 	DisableCollapse bool `json:"DisableCollapse"` // only for folder
 
+	// Feed publishes the folder's pages as Atom and RSS feeds, see FeedLink. Only for folder.
+	Feed bool `json:"Feed"`
+
 	// Link is the URL to navigate to when this item is clicked.
 	// For files, this is the path to the file (e.g., "/p/path").
 	Link string `json:"Link"`
@@ -44,64 +51,228 @@ type SidebarItem struct {
 	// Path is the relative path to the file or folder in PUB_DIR.
 	Path string `json:"Path"`
 
+	// File Only: front matter hidden, left out of the sidebar but still built and
+	// reachable by URL. Not saved to layout.json.
+	Hidden bool `json:"-"`
+
+	// File Only: front matter draft, only built in edit mode. Not saved to layout.json.
+	Draft bool `json:"-"`
+
 	// 1-indexed position in parent slice. On update, all items are sorted
 	// by this(alphabetically if 0), then all set to their final index+1
 	Position int `json:"Position"`
 
+	// File Only: front matter tags, used as search facets. Not saved to layout.json.
+	Tags []string `json:"-"`
+
 	// Children are the child items of this item, if any.
 	Children []*SidebarItem `json:"Children"`
+
+	// layout.json values of the settings front matter replaced, see Saved.
+	saved layoutValues
+}
+
+// layoutValues holds the layout.json values of the settings front matter
+// replaced. Nil ones weren't replaced.
+type layoutValues struct {
+	Label    *string
+	Position *int
+	Template *string
+	Icon     *template.HTML
+}
+
+// applyFrontMatter merges the file's front matter into the item. Front matter
+// wins over layout.json since it lives next to the content. The replaced
+// values are kept and saved instead, so removing a key brings them back.
+func (si *SidebarItem) applyFrontMatter(fm *html.FrontMatter) {
+	if fm.Label != "" {
+		old := si.Label
+		si.saved.Label = &old
+		si.Label = fm.Label
+	}
+	if fm.Position > 0 {
+		old := si.Position
+		si.saved.Position = &old
+		si.Position = fm.Position
+	}
+	if fm.Template != "" {
+		old := si.Template
+		si.saved.Template = &old
+		si.Template = fm.Template
+	}
+	if fm.Icon != "" {
+		old := si.Icon
+		si.saved.Icon = &old
+		si.Icon = template.HTML(fm.Icon)
+	}
+	si.Hidden = fm.Hidden
+	si.Draft = fm.Draft
+	si.Tags = fm.Tags
+}
+
+// Saved returns a copy of the item as it's saved to layout.json, with the
+// settings front matter replaced set back. The edit UI edits these.
+func (si *SidebarItem) Saved() *SidebarItem {
+	out := *si
+	if v := si.saved.Label; v != nil {
+		out.Label = *v
+	}
+	if v := si.saved.Position; v != nil {
+		out.Position = *v
+	}
+	if v := si.saved.Template; v != nil {
+		out.Template = *v
+	}
+	if v := si.saved.Icon; v != nil {
+		out.Icon = *v
+	}
+	out.saved = layoutValues{}
+	return &out
+}
+
+// MarshalJSON saves the layout.json values, not the ones from front matter.
+func (si *SidebarItem) MarshalJSON() ([]byte, error) {
+	type plain SidebarItem // without this method
+	return json.Marshal((*plain)(si.Saved()))
+}
+
+// FeedLink returns the URL of this folder's feed, kind is "atom" or "rss".
+func (si *SidebarItem) FeedLink(kind string) string {
+	return "/f/" + si.Path + "/" + kind + ".xml"
 }
 
 // Render executes the page for this sidebar item.
 func (si *SidebarItem) Render(templates *template.Template, layout *Layout, pathToHash map[string]string, debug bool) (string, error) {
+	out, _, err := si.RenderPage(templates, layout, pathToHash, debug)
+	return out, err
+}
+
+// RenderPage is Render that also returns the page data the template got.
+func (si *SidebarItem) RenderPage(templates *template.Template, layout *Layout, pathToHash map[string]string, debug bool) (string, *Page, error) {
 	if si.Type != "file" {
-		return "", fmt.Errorf("sidebar item is not a file or hidden: %v", si)
+		return "", nil, fmt.Errorf("sidebar item is not a file or hidden: %v", si)
 	}
 	path := filepath.Join(paths.PUB_DIR, si.Path)
-	if out, err := Render(path, si.Template, templates, layout, pathToHash, debug); err != nil {
-		return "", fmt.Errorf("error rendering sidebar item %v: %w", si, err)
+	if out, page, err := RenderPage(path, si.Template, templates, layout, pathToHash, debug); err != nil {
+		return "", nil, fmt.Errorf("error rendering sidebar item %v: %w", si, err)
 	} else {
-		return out, nil
+		return out, page, nil
+	}
+}
+
+const maxDescription = 160 // runes, for generated descriptions
+
+// Page is the per-page data passed to templates as .Page.
+type Page struct {
+	Title       string         // front matter title, else the first h1
+	Description string         // front matter description, else the first paragraph
+	URL         string         // path, e.g. "/p/usage/deployment", empty for reserved pages like .404.md
+	Canonical   string         // IM_BASE_URL + URL, empty if IM_BASE_URL is not set
+	Image       string         // absolute og:image url from the "image" param or site icon, empty if IM_BASE_URL is not set
+	Params      map[string]any // front matter keys that aren't SidebarItem settings
+}
+
+// pageURL returns the URL a file in PUB_DIR is served at, "" for reserved
+// files other than the index, e.g. `.404.md`.
+func pageURL(path string) string {
+	rel, err := filepath.Rel(paths.PUB_DIR, path)
+	if err != nil || rel == ".index.md" {
+		return "/"
+	}
+	if strings.HasPrefix(rel, ".") {
+		return ""
 	}
+	rel = filepath.ToSlash(rel)
+	return "/p/" + strings.TrimSuffix(rel, filepath.Ext(rel))
 }
 
 // Render executes the given page with the content of the given filepath as the content.
 // Not in SidebarItem.Render() because it's used for the index page as well.
 func Render(path, tmpl string, templates *template.Template, layout *Layout, pathToHash map[string]string, debug bool) (string, error) {
+	out, _, err := RenderPage(path, tmpl, templates, layout, pathToHash, debug)
+	return out, err
+}
+
+// RenderPage is Render that also returns the page data the template got,
+// e.g. for the search index to know the title.
+func RenderPage(path, tmpl string, templates *template.Template, layout *Layout, pathToHash map[string]string, debug bool) (string, *Page, error) {
 	if path == "" {
-		return "", fmt.Errorf("path is empty")
+		return "", nil, fmt.Errorf("path is empty")
 	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return renderData(path, src, tmpl, templates, layout, pathToHash, debug)
+}
+
+// RenderData is Render with the file's content passed in, used to preview unsaved edits.
+func RenderData(path string, src []byte, tmpl string, templates *template.Template, layout *Layout, pathToHash map[string]string, debug bool) (string, error) {
+	out, _, err := renderData(path, src, tmpl, templates, layout, pathToHash, debug)
+	return out, err
+}
+
+func renderData(path string, src []byte, tmpl string, templates *template.Template, layout *Layout, pathToHash map[string]string, debug bool) (string, *Page, error) {
 	if tmpl == "" {
-		return "", fmt.Errorf("template is empty")
+		return "", nil, fmt.Errorf("template is empty")
 	}
 	if !strings.HasSuffix(path, ".html") && !strings.HasSuffix(path, ".md") {
-		return "", fmt.Errorf("path %s must end with .html or .md", path)
+		return "", nil, fmt.Errorf("path %s must end with .html or .md", path)
 	}
 
 	editMode := flags.PresentAny("-e", "--edit")
 
+	// get page data
+	fm, _, err := html.SplitFrontMatter(src)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading front matter %s: %w", path, err)
+	}
+	page := &Page{Title: fm.Title, Description: fm.Description, URL: pageURL(path), Params: fm.Params}
+	if base := strings.TrimSuffix(env.Get(env.IM_BASE_URL), "/"); base != "" && page.URL != "" {
+		page.Canonical = base + page.URL
+		if img, ok := fm.Params["image"].(string); ok && strings.HasPrefix(img, "/") {
+			page.Image = base + img
+		} else if ok {
+			page.Image = img
+		} else if layout.IconHref != "" {
+			page.Image = base + layout.IconHref
+		}
+	}
+
 	// get content
-	data, err := html.FromFile(path, map[string]any{
+	data, err := html.FromData(path, src, map[string]any{
 		"Layout":   layout,
+		"Page":     page,
 		"Themes":   themes.All,
 		"EditMode": editMode,
 		"Debug":    debug,
 	})
 	if err != nil {
-		return "", fmt.Errorf("error processing file %s: %w", path, err)
+		return "", nil, fmt.Errorf("error processing file %s: %w", path, err)
+	}
+
+	// fall back to the content for title and description
+	if page.Title == "" || page.Description == "" {
+		title, desc, err := html.Summary(data, maxDescription)
+		if err != nil {
+			return "", nil, fmt.Errorf("error summarizing file %s: %w", path, err)
+		}
+		page.Title = sins.Ternary(page.Title == "", title, page.Title)
+		page.Description = sins.Ternary(page.Description == "", desc, page.Description)
 	}
 
 	// execute the template with the data
 	var outBuf bytes.Buffer
 	if err := templates.ExecuteTemplate(&outBuf, tmpl, map[string]any{
 		"Layout":   layout,
+		"Page":     page,
 		"Content":  template.HTML(string(data)),
 		"Themes":   themes.All,
 		"EditMode": editMode,
 		"EditPage": false,
 		"Debug":    debug,
 	}); err != nil {
-		return "", fmt.Errorf("error executing template %s: %w", tmpl, err)
+		return "", nil, fmt.Errorf("error executing template %s: %w", tmpl, err)
 	}
 	out := outBuf.String()
 
@@ -110,5 +281,5 @@ func Render(path, tmpl string, templates *template.Template, layout *Layout, pat
 		out = stringsx.FastLinkReplace(out, pathToHash)
 	}
 
-	return out, nil
+	return out, page, nil
 }
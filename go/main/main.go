@@ -90,7 +90,20 @@ func main() {
 
 	edit := flags.PresentAny("-e", "--edit")
 
-	if !edit && env.Get(env.IM_UPDATE_SECRET) == "" {
+	// static export
+	if flags.Present("export") {
+		outDir, ok := flags.Value("export")
+		if !ok {
+			outDir = "export"
+		}
+		if err := router.Export(ctx, outDir, flags.Present("--gzip"), debug); err != nil {
+			exit("Error exporting site, see logs for details", err, log)
+		}
+		fmt.Println("Exported site to " + outDir)
+		return
+	}
+
+	if !edit && env.Get(env.IM_UPDATE_SECRET) == "" && env.Get(env.IM_POLL_M) == "0" {
 		fmt.Println("")
 		fmt.Println("Warning: IM_UPDATE_SECRET environment variable is not set. This is required for automatic updates to work.")
 		fmt.Println("See https://intermark.dev/p/usage/deployment for more information.")
@@ -98,6 +111,21 @@ func main() {
 		log.Warn("IM_UPDATE_SECRET environment variable is not set. This is required for automatic updates to work.")
 	}
 
+	// check content remote / branch
+	if !edit {
+		remote, branch := env.Get(env.IM_GIT_REMOTE), env.Get(env.IM_GIT_BRANCH)
+		bCtx, bCancel := context.WithTimeout(ctx, time.Second*5)
+		defer bCancel()
+		bVer, err := git.GetRemoteCommitHash(bCtx, cwd, remote, branch)
+		if err != nil {
+			exit(fmt.Sprintf("Error finding %s/%s. Check IM_GIT_REMOTE and IM_GIT_BRANCH, and that the branch has been fetched (`git fetch %s %s`)", remote, branch, remote, branch), err, log)
+		}
+		if bVer != urVer {
+			log.Warnf("Configured content branch %s/%s (%s) differs from the checkout's upstream (%s). Updates will reset to %s/%s.", remote, branch, bVer, urVer, remote, branch)
+		}
+		log.Infof("Content branch: %s/%s, hash: %s", remote, branch, bVer)
+	}
+
 	// create router
 	r, err := router.New(ctx, ipc, iac, edit, debug)
 	if err != nil {
@@ -1,9 +1,13 @@
 package paths
 
 const (
-	TMPL_DIR = "go/templates"
-	LAYOUT   = "./public/.meta/layout.json"
-	PUB_DIR  = "public"
-	DIST_DIR = "public/.meta/dist"
-	ASS_DIR  = "assets"
+	TMPL_DIR        = "go/templates"
+	LAYOUT          = "./public/.meta/layout.json"
+	PUB_DIR         = "public"
+	DIST_DIR        = "public/.meta/dist"
+	UPDATE_HISTORY  = "./public/.meta/update-history.json"
+	REDIRECTS       = "./public/.meta/redirects.json" // hand written
+	RENAMES         = "./public/.meta/renames.json"   // detected from git by prod
+	EXPORT_DIST_DIR = "public/.meta/dist-export"
+	ASS_DIR         = "assets"
 )
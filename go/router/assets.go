@@ -0,0 +1,371 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"intermark/go/env"
+	"intermark/go/files"
+	"intermark/go/flags"
+	"intermark/go/paths"
+	"intermark/go/stringsx"
+	"intermark/go/system/tailwind"
+	"intermark/go/themes"
+)
+
+// Edit mode asset manager. Asset paths in requests are relative to ASS_DIR,
+// e.g. "img/logo.png" for /assets/img/logo.png.
+
+const maxScanBytes = 8 << 20 // files bigger than this aren't scanned for asset links
+
+var errBadAsset = errors.New("invalid asset path")
+
+// asset is a file in ASS_DIR and where it's linked from.
+type asset struct {
+	Path   string   `json:"path"` // link, e.g. "/assets/img/logo.png"
+	Size   int64    `json:"size"`
+	Kind   string   `json:"kind"`   // "image", "video", or "" for no preview
+	UsedBy []string `json:"usedBy"` // files linking to it
+	Orphan bool     `json:"orphan"` // linked from nowhere
+}
+
+// missingAsset is a link to an asset that doesn't exist.
+type missingAsset struct {
+	Path   string   `json:"path"`
+	UsedBy []string `json:"usedBy"`
+}
+
+type assetReport struct {
+	Assets  []asset        `json:"assets"`
+	Missing []missingAsset `json:"missing"`
+}
+
+func (r *Router) setupAssetRoutes() {
+	uploadMB, err := strconv.ParseInt(env.Get(env.IM_UPLOAD_MB), 10, 64)
+	if err != nil || uploadMB <= 0 {
+		r.log.Warnf("invalid IM_UPLOAD_MB %q, using 100\n", env.Get(env.IM_UPLOAD_MB))
+		uploadMB = 100
+	}
+
+	// serve asset manager
+	r.Router.Get("/edit/assets", func(res http.ResponseWriter, req *http.Request) {
+		err := r.refresh()
+		r.editMu.RLock()
+		defer r.editMu.RUnlock()
+		if err != nil {
+			r.log.Errorf("error refreshing edit mode: %v\n", err)
+			http.Error(res, "Edit refresh error", http.StatusInternalServerError)
+			return
+		}
+		report, err := r.scanAssets()
+		if err != nil {
+			r.log.Errorf("error scanning assets: %v\n", err)
+			http.Error(res, "Asset scan error", http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := r.templates.ExecuteTemplate(res, "edit-assets.html", map[string]any{
+			"Layout":    r.layout,
+			"Themes":    themes.All,
+			"EditMode":  flags.PresentAny("-e", "--edit"),
+			"EditPage":  true,
+			"Debug":     r.debugMode,
+			"Report":    report,
+			"MaxUpload": uploadMB,
+		}); err != nil {
+			r.log.Errorf("error executing template: %v\n", err)
+			http.Error(res, "Template render error", http.StatusInternalServerError)
+		}
+	})
+
+	// usage scan as JSON
+	r.Router.Get("/edit/assets/usage", func(res http.ResponseWriter, req *http.Request) {
+		r.editMu.RLock()
+		defer r.editMu.RUnlock()
+		report, err := r.scanAssets()
+		if err != nil {
+			r.log.Errorf("error scanning assets: %v\n", err)
+			http.Error(res, "Asset scan error", http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(report)
+	})
+
+	// upload, multipart "files" into the optional "dir"
+	r.Router.With(sameOrigin).Post("/edit/assets/upload", func(res http.ResponseWriter, req *http.Request) {
+		req.Body = http.MaxBytesReader(res, req.Body, uploadMB<<20)
+		if err := req.ParseMultipartForm(32 << 20); err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				http.Error(res, fmt.Sprintf("Upload is over the %d MB limit", uploadMB), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(res, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer req.MultipartForm.RemoveAll()
+		r.editMu.Lock()
+		defer r.editMu.Unlock()
+
+		// check everything before writing anything
+		dir := strings.Trim(req.FormValue("dir"), "/")
+		headers := req.MultipartForm.File["files"]
+		if len(headers) == 0 {
+			http.Error(res, "No files", http.StatusBadRequest)
+			return
+		}
+		dsts := make([]string, len(headers))
+		seen := map[string]bool{}
+		for i, h := range headers {
+			rel := path.Join(dir, path.Base(strings.ReplaceAll(h.Filename, "\\", "/")))
+			dst, err := assetPath(rel)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if seen[dst] {
+				http.Error(res, fmt.Sprintf("%s is in the upload more than once", rel), http.StatusConflict)
+				return
+			}
+			seen[dst] = true
+			if exists, err := files.Exists(dst); err != nil || exists {
+				http.Error(res, fmt.Sprintf("%s already exists, rename or delete it first", rel), http.StatusConflict)
+				return
+			}
+			dsts[i] = dst
+		}
+		for i, h := range headers {
+			if err := saveUpload(h, dsts[i]); err != nil {
+				r.log.Errorf("error saving upload %s: %v\n", dsts[i], err)
+				http.Error(res, "Failed to save "+h.Filename, http.StatusInternalServerError)
+				return
+			}
+			r.log.Debugf("Uploaded asset %s\n", dsts[i])
+		}
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	// rename or move
+	r.Router.With(sameOrigin).Post("/edit/assets/move", func(res http.ResponseWriter, req *http.Request) {
+		var op fileOp
+		if err := json.NewDecoder(http.MaxBytesReader(res, req.Body, 1<<20)).Decode(&op); err != nil {
+			http.Error(res, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.editMu.Lock()
+		defer r.editMu.Unlock()
+		from, err := assetPath(op.From)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := assetPath(op.To)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if info, err := os.Stat(from); err != nil || info.IsDir() {
+			http.Error(res, "Not found", http.StatusNotFound)
+			return
+		}
+		if exists, err := files.Exists(to); err != nil || exists {
+			http.Error(res, op.To+" already exists", http.StatusConflict)
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+			r.log.Errorf("error creating asset dir for %s: %v\n", to, err)
+			http.Error(res, "Failed to move asset", http.StatusInternalServerError)
+			return
+		}
+		if err := os.Rename(from, to); err != nil {
+			r.log.Errorf("error moving asset %s to %s: %v\n", from, to, err)
+			http.Error(res, "Failed to move asset", http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	// delete
+	r.Router.With(sameOrigin).Post("/edit/assets/delete", func(res http.ResponseWriter, req *http.Request) {
+		var op fileOp
+		if err := json.NewDecoder(http.MaxBytesReader(res, req.Body, 1<<20)).Decode(&op); err != nil {
+			http.Error(res, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.editMu.Lock()
+		defer r.editMu.Unlock()
+		p, err := assetPath(op.Path)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			http.Error(res, "Not found", http.StatusNotFound)
+			return
+		}
+		if err := os.Remove(p); err != nil {
+			r.log.Errorf("error deleting asset %s: %v\n", p, err)
+			http.Error(res, "Failed to delete asset", http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// assetPath checks rel names a file that can live in ASS_DIR and be linked
+// to, and returns its filesystem path.
+func assetPath(rel string) (string, error) {
+	if rel == "" || path.Clean(rel) != rel || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%w: %q", errBadAsset, rel)
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") || !stringsx.LinkSafe(part) {
+			return "", fmt.Errorf("%w: %q, names can't start with a dot or have spaces, quotes, or brackets", errBadAsset, rel)
+		}
+	}
+	p := filepath.Join(paths.ASS_DIR, filepath.FromSlash(rel))
+	if p == filepath.Clean(tailwind.OUTPUT_PATH) {
+		return "", fmt.Errorf("%w: %q is generated by Tailwind", errBadAsset, rel)
+	}
+	if in, err := files.Within(paths.ASS_DIR, p); err != nil {
+		return "", err
+	} else if !in {
+		return "", fmt.Errorf("%w: %q is outside %s", errBadAsset, rel, paths.ASS_DIR)
+	}
+	return p, nil
+}
+
+// saveUpload copies an uploaded file to dst through a temp file, so a failed
+// upload doesn't leave part of a file behind.
+func saveUpload(h *multipart.FileHeader, dst string) error {
+	src, err := h.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// scanAssets lists ASS_DIR and finds every /assets/ link in PUB_DIR (which has
+// app.css) and the templates, the same links FastLinkReplace fingerprints.
+// Caller holds editMu.
+func (r *Router) scanAssets() (*assetReport, error) {
+	usedBy := map[string][]string{} // link -> files
+	addLinks := func(file string, data []byte) {
+		seen := map[string]bool{}
+		for _, link := range stringsx.AssetLinks(string(data)) {
+			link, _, _ = strings.Cut(link, "?") // cache busting queries
+			link, _, _ = strings.Cut(link, "#")
+			if unescaped, err := url.PathUnescape(link); err == nil {
+				link = unescaped
+			}
+			if link == "/assets/" || strings.ContainsAny(link, "*{") { // docs placeholders and globs
+				continue
+			}
+			if !seen[link] {
+				seen[link] = true
+				usedBy[link] = append(usedBy[link], file)
+			}
+		}
+	}
+	for _, root := range []string{paths.PUB_DIR, paths.TMPL_DIR} {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p == filepath.Clean(paths.DIST_DIR) || p == filepath.Clean(paths.EXPORT_DIST_DIR) || d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err != nil || info.Size() > maxScanBytes {
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %w", p, err)
+			}
+			addLinks(filepath.ToSlash(p), data)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning %s for asset links: %w", root, err)
+		}
+	}
+	if r.layout.IconHref != "" {
+		usedBy[r.layout.IconHref] = append(usedBy[r.layout.IconHref], "site icon")
+	}
+
+	report := &assetReport{Assets: []asset{}, Missing: []missingAsset{}}
+	exists := map[string]bool{}
+	outCSS := filepath.Clean(tailwind.OUTPUT_PATH)
+	err := filepath.WalkDir(paths.ASS_DIR, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || p == outCSS || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := "/" + filepath.ToSlash(p)
+		exists[link] = true
+		kind, _, _ := strings.Cut(mime.TypeByExtension(filepath.Ext(p)), "/")
+		if kind != "image" && kind != "video" {
+			kind = ""
+		}
+		report.Assets = append(report.Assets, asset{
+			Path:   link,
+			Size:   info.Size(),
+			Kind:   kind,
+			UsedBy: usedBy[link],
+			Orphan: len(usedBy[link]) == 0,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", paths.ASS_DIR, err)
+	}
+	for link, by := range usedBy {
+		if !exists[link] && link != "/"+filepath.ToSlash(outCSS) {
+			report.Missing = append(report.Missing, missingAsset{Path: link, UsedBy: by})
+		}
+	}
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Path < report.Missing[j].Path })
+	return report, nil
+}
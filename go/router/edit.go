@@ -1,8 +1,13 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"path/filepath"
 
 	"intermark/go/flags"
@@ -12,15 +17,24 @@ import (
 )
 
 func (r *Router) setupEditRoutes() {
+	// unknown routes
+	r.Router.NotFound(func(res http.ResponseWriter, req *http.Request) {
+		r.editMu.RLock()
+		defer r.editMu.RUnlock()
+		if redirect(res, req, r.layout) {
+			return
+		}
+		r.editError(res, http.StatusNotFound, "404 page not found")
+	})
+
 	// serve landing page
 	r.Router.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		err := r.refresh() // cheap when nothing changed
 		r.editMu.RLock()
 		defer r.editMu.RUnlock()
-
-		// refresh
-		if err := r.refresh(); err != nil {
-			r.log.Errorf("error refreshing edit mode: %v", err)
-			http.Error(res, "Edit refresh error", http.StatusInternalServerError)
+		if err != nil {
+			r.log.Errorf("error refreshing edit mode: %v\n", err)
+			r.editError(res, http.StatusInternalServerError, "Edit refresh error")
 			return
 		}
 
@@ -28,7 +42,7 @@ func (r *Router) setupEditRoutes() {
 		data, err := layout.Render(filepath.Join(paths.PUB_DIR, ".index.md"), r.layout.IndexTmpl, r.templates, r.layout, nil, r.debugMode)
 		if err != nil {
 			r.log.Errorf("error processing index file: %v\n", err)
-			http.Error(res, "Index file error", http.StatusInternalServerError)
+			r.editError(res, http.StatusInternalServerError, "Index file error")
 			return
 		} else {
 			res.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -38,13 +52,12 @@ func (r *Router) setupEditRoutes() {
 
 	// serve page
 	r.Router.Get("/p/*", func(res http.ResponseWriter, req *http.Request) {
+		err := r.refresh() // cheap when nothing changed
 		r.editMu.RLock()
 		defer r.editMu.RUnlock()
-
-		// refresh
-		if err := r.refresh(); err != nil {
-			r.log.Errorf("error refreshing edit mode: %v", err)
-			http.Error(res, "Edit refresh error", http.StatusInternalServerError)
+		if err != nil {
+			r.log.Errorf("error refreshing edit mode: %v\n", err)
+			r.editError(res, http.StatusInternalServerError, "Edit refresh error")
 			return
 		}
 
@@ -55,22 +68,25 @@ func (r *Router) setupEditRoutes() {
 		if err != nil {
 			r.log.Errorf("error getting sidebar item: %s, %v\n", rel, err)
 			if err == layout.ErrItemNotFound {
-				http.NotFound(res, req)
+				if redirect(res, req, r.layout) {
+					return
+				}
+				r.editError(res, http.StatusNotFound, "404 page not found")
 				return
 			}
-			http.Error(res, "Sidebar item error", http.StatusInternalServerError)
+			r.editError(res, http.StatusInternalServerError, "Sidebar item error")
 			return
 		}
 		if si.Type != "file" {
 			r.log.Errorf("sidebar item %s is hidden or not a file\n", rel)
-			http.NotFound(res, req)
+			r.editError(res, http.StatusNotFound, "404 page not found")
 			return
 		}
 
 		// serve page
 		if data, err := si.Render(r.templates, r.layout, nil, r.debugMode); err != nil {
 			r.log.Errorf("error executing template: %v\n", err)
-			http.Error(res, "Template render error", http.StatusInternalServerError)
+			r.editError(res, http.StatusInternalServerError, "Template render error")
 			return
 		} else {
 			res.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -80,12 +96,11 @@ func (r *Router) setupEditRoutes() {
 
 	// serve edit
 	r.Router.Get("/edit", func(res http.ResponseWriter, req *http.Request) {
+		err := r.refresh()
 		r.editMu.RLock()
 		defer r.editMu.RUnlock()
-
-		// refresh
-		if err := r.refresh(); err != nil {
-			r.log.Errorf("error refreshing edit mode: %v", err)
+		if err != nil {
+			r.log.Errorf("error refreshing edit mode: %v\n", err)
 			http.Error(res, "Edit refresh error", http.StatusInternalServerError)
 			return
 		}
@@ -103,9 +118,20 @@ func (r *Router) setupEditRoutes() {
 		}
 	})
 
-	r.Router.Post("/edit-sidebar", func(res http.ResponseWriter, req *http.Request) {
-		r.editMu.RLock()
-		defer r.editMu.RUnlock()
+	// live reload events for open pages
+	r.Router.Get("/edit/events", r.liveEvents)
+
+	r.setupEditorRoutes()
+	r.setupAssetRoutes()
+
+	// update layout, stale writes get a 409 with the current sidebar
+	r.Router.With(sameOrigin).Post("/edit-sidebar", func(res http.ResponseWriter, req *http.Request) {
+		// pick up template changes
+		if err := r.refresh(); err != nil {
+			r.log.Errorf("error refreshing edit mode: %v\n", err)
+			http.Error(res, "Edit refresh error", http.StatusInternalServerError)
+			return
+		}
 		// read body
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
@@ -113,44 +139,126 @@ func (r *Router) setupEditRoutes() {
 			http.Error(res, "Failed to read request body", http.StatusInternalServerError)
 			return
 		}
-		// parse JSON
-		if err := r.layout.FromJSON(r.ctx, body); err != nil {
+		r.editMu.Lock()
+		defer r.editMu.Unlock()
+		// version check, no If-Match means overwrite
+		if match := req.Header.Get("If-Match"); match != "" && match != "*" && match != layoutETag(r.layout) {
+			r.log.Debugf("Stale layout write, %s != %s\n", match, layoutETag(r.layout))
+			r.writeSidebar(res, http.StatusConflict)
+			return
+		}
+		// parse JSON into a new layout so a bad update leaves the current one alone
+		l := &layout.Layout{}
+		if err := l.FromJSON(r.ctx, body); err != nil {
 			r.log.Errorf("error updating layout from JSON: %v", err)
 			http.Error(res, "Invalid JSON or update error: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		// load templates
-		if err := r.loadTemplates(); err != nil {
-			r.log.Errorf("error loading templates: %v", err)
-			http.Error(res, "Template load error", http.StatusInternalServerError)
+		r.layout = l
+		r.writeSidebar(res, http.StatusOK)
+	})
+
+	// page and folder changes, each responds with the new sidebar like /edit-sidebar
+	r.Router.With(sameOrigin).Post("/edit/new", r.fileOp(func(op fileOp) error {
+		if op.Type == "folder" {
+			return r.layout.CreateFolder(r.ctx, op.Path)
+		}
+		return r.layout.CreatePage(r.ctx, op.Path)
+	}))
+	r.Router.With(sameOrigin).Post("/edit/move", r.fileOp(func(op fileOp) error {
+		return r.layout.Move(r.ctx, op.From, op.To, op.Redirect)
+	}))
+	r.Router.With(sameOrigin).Post("/edit/delete", r.fileOp(func(op fileOp) error {
+		return r.layout.Delete(r.ctx, op.Path)
+	}))
+}
+
+// fileOp is the body of the page and folder change requests. Paths are
+// relative to PUB_DIR, e.g. "usage/deployment.md".
+type fileOp struct {
+	Type     string `json:"type"` // for new, "file" or "folder"
+	Path     string `json:"path"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Redirect bool   `json:"redirect"` // for move, leave a redirect at the old URL
+}
+
+// fileOp wraps a filesystem change to the layout in the same locking and
+// version check as /edit-sidebar.
+func (r *Router) fileOp(apply func(op fileOp) error) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var op fileOp
+		if err := json.NewDecoder(http.MaxBytesReader(res, req.Body, 1<<20)).Decode(&op); err != nil {
+			http.Error(res, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		// execute sidebar template
-		err = r.templates.ExecuteTemplate(res, "sidebar", map[string]any{
-			"Layout":   r.layout,
-			"Themes":   themes.All,
-			"EditMode": flags.PresentAny("-e", "--edit"),
-			"EditPage": true,
-			"Debug":    r.debugMode,
-		})
-		if err != nil {
-			r.log.Errorf("error executing template: %v", err)
-			http.Error(res, "Template render error", http.StatusInternalServerError)
+		r.editMu.Lock()
+		defer r.editMu.Unlock()
+		if match := req.Header.Get("If-Match"); match != "" && match != "*" && match != layoutETag(r.layout) {
+			r.writeSidebar(res, http.StatusConflict)
+			return
+		}
+		if err := apply(op); err != nil {
+			switch {
+			case errors.Is(err, layout.ErrInvalidPath):
+				http.Error(res, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, layout.ErrExists), errors.Is(err, layout.ErrNotEmpty):
+				http.Error(res, err.Error(), http.StatusConflict)
+			case errors.Is(err, fs.ErrNotExist):
+				http.Error(res, "Not found", http.StatusNotFound)
+			default:
+				r.log.Errorf("error changing %s: %v\n", req.URL.Path, err)
+				http.Error(res, "Failed to apply change", http.StatusInternalServerError)
+			}
 			return
 		}
+		r.log.Debugf("Applied %s: %+v\n", req.URL.Path, op)
+		r.writeSidebar(res, http.StatusOK)
+	}
+}
+
+// sameOrigin rejects edit mode writes sent from other sites. The edit server
+// listens on every interface without auth, so without this any page open in
+// the author's browser could post a form that overwrites content. Requests
+// without either header aren't from a browser and are let through.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if site := req.Header.Get("Sec-Fetch-Site"); site != "" {
+			if site != "same-origin" && site != "none" {
+				http.Error(res, "Cross-site edit requests are not allowed", http.StatusForbidden)
+				return
+			}
+		} else if origin := req.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != req.Host {
+				http.Error(res, "Cross-site edit requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(res, req)
 	})
 }
 
-// refresh loads the templates, layout, and runs Tailwind.
-func (r *Router) refresh() error {
-	if err := r.loadTemplates(); err != nil {
-		return err
-	}
-	if err := r.RunTailwind(); err != nil {
-		return err
-	}
-	if err := r.layout.FromFile(r.ctx); err != nil {
-		return err
+// layoutETag is the ETag for l's version.
+func layoutETag(l *layout.Layout) string {
+	return `"` + l.Version + `"`
+}
+
+// writeSidebar renders the edit page's sidebar with the layout's ETag. Caller holds editMu.
+func (r *Router) writeSidebar(res http.ResponseWriter, status int) {
+	var buf bytes.Buffer
+	if err := r.templates.ExecuteTemplate(&buf, "sidebar", map[string]any{
+		"Layout":   r.layout,
+		"Themes":   themes.All,
+		"EditMode": flags.PresentAny("-e", "--edit"),
+		"EditPage": true,
+		"Debug":    r.debugMode,
+	}); err != nil {
+		r.log.Errorf("error executing template: %v", err)
+		http.Error(res, "Template render error", http.StatusInternalServerError)
+		return
 	}
-	return nil
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("ETag", layoutETag(r.layout))
+	res.WriteHeader(status)
+	res.Write(buf.Bytes())
 }
@@ -0,0 +1,162 @@
+package router
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"intermark/go/files"
+	"intermark/go/flags"
+	"intermark/go/html"
+	"intermark/go/layout"
+	"intermark/go/paths"
+	"intermark/go/themes"
+
+	"github.com/minio/sha256-simd"
+)
+
+const maxPageBytes = 10 << 20 // largest page the editor will save or preview
+
+// setupEditorRoutes adds the in browser page editor. The rel path in each
+// route is a page's URL path, like /p/*.
+func (r *Router) setupEditorRoutes() {
+	// serve editor
+	r.Router.Get("/edit/p/*", func(res http.ResponseWriter, req *http.Request) {
+		err := r.refresh()
+		r.editMu.RLock()
+		defer r.editMu.RUnlock()
+		if err != nil {
+			r.log.Errorf("error refreshing edit mode: %v\n", err)
+			http.Error(res, "Edit refresh error", http.StatusInternalServerError)
+			return
+		}
+		rel := strings.TrimPrefix(req.URL.Path, "/edit/p/")
+		si, path, ok := r.editorFile(res, rel)
+		if !ok {
+			return
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			r.log.Errorf("error reading page %s: %v\n", path, err)
+			http.Error(res, "Failed to read page", http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := r.templates.ExecuteTemplate(res, "edit-page.html", map[string]any{
+			"Layout":   r.layout,
+			"Themes":   themes.All,
+			"EditMode": flags.PresentAny("-e", "--edit"),
+			"EditPage": true,
+			"Debug":    r.debugMode,
+			"Item":     si,
+			"URL":      "/p/" + rel,
+			"Source":   string(src),
+			"Version":  sourceVersion(src),
+		}); err != nil {
+			r.log.Errorf("error executing template: %v\n", err)
+			http.Error(res, "Template render error", http.StatusInternalServerError)
+		}
+	})
+
+	// save page, stale writes get a 409 unless If-Match is "*" or missing
+	r.Router.With(sameOrigin).Post("/edit/p/*", func(res http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxPageBytes))
+		if err != nil {
+			r.log.Errorf("error reading request body: %v\n", err)
+			http.Error(res, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.editMu.Lock() // the watcher's refresh waits for the whole save
+		defer r.editMu.Unlock()
+		rel := strings.TrimPrefix(req.URL.Path, "/edit/p/")
+		_, path, ok := r.editorFile(res, rel)
+		if !ok {
+			return
+		}
+		cur, err := os.ReadFile(path)
+		if err != nil {
+			r.log.Errorf("error reading page %s: %v\n", path, err)
+			http.Error(res, "Failed to read page", http.StatusInternalServerError)
+			return
+		}
+		if match := req.Header.Get("If-Match"); match != "" && match != "*" && match != `"`+sourceVersion(cur)+`"` {
+			res.Header().Set("ETag", `"`+sourceVersion(cur)+`"`)
+			http.Error(res, "Page changed on disk since it was opened", http.StatusConflict)
+			return
+		}
+		if err := files.WriteAtomic(path, body, 0o644); err != nil {
+			r.log.Errorf("error saving page %s: %v\n", path, err)
+			http.Error(res, "Failed to save page", http.StatusInternalServerError)
+			return
+		}
+		r.log.Debugf("Saved page %s\n", path)
+		res.Header().Set("ETag", `"`+sourceVersion(body)+`"`)
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	// preview unsaved content through the page's template
+	r.Router.With(sameOrigin).Post("/edit/preview/p/*", func(res http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxPageBytes))
+		if err != nil {
+			r.log.Errorf("error reading request body: %v\n", err)
+			http.Error(res, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.editMu.RLock()
+		defer r.editMu.RUnlock()
+		rel := strings.TrimPrefix(req.URL.Path, "/edit/preview/p/")
+		si, path, ok := r.editorFile(res, rel)
+		if !ok {
+			return
+		}
+		tmpl := si.Template
+		if fm, _, err := html.SplitFrontMatter(body); err == nil && fm.Template != "" {
+			tmpl = fm.Template
+		}
+		data, err := layout.RenderData(path, body, tmpl, r.templates, r.layout, nil, r.debugMode)
+		if err != nil {
+			// shown in the preview pane, the content is the user's own
+			http.Error(res, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		res.Write([]byte(data))
+	})
+}
+
+// editorFile returns the sidebar item for rel and its file path, writing an
+// error response and returning false if it isn't an editable page. Caller holds editMu.
+func (r *Router) editorFile(res http.ResponseWriter, rel string) (*layout.SidebarItem, string, bool) {
+	si, err := r.layout.GetSidebarItem(rel)
+	if err != nil || si.Type != "file" {
+		http.Error(res, "404 page not found", http.StatusNotFound)
+		return nil, "", false
+	}
+	path := filepath.Join(paths.PUB_DIR, si.Path)
+	ext := strings.ToLower(filepath.Ext(path))
+	inPub, err := files.Within(paths.PUB_DIR, path)
+	if err != nil {
+		r.log.Errorf("error checking page path %s: %v\n", path, err)
+		http.Error(res, "Failed to check page path", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	if !inPub {
+		r.log.Warnf("refusing to edit %s, it's outside %s\n", path, paths.PUB_DIR)
+		http.Error(res, "Page is outside "+paths.PUB_DIR, http.StatusForbidden)
+		return nil, "", false
+	}
+	if ext != ".md" && ext != ".html" {
+		http.Error(res, "Only .md and .html pages can be edited", http.StatusForbidden)
+		return nil, "", false
+	}
+	return si, path, true
+}
+
+// sourceVersion identifies a page's content for the editor's If-Match.
+func sourceVersion(src []byte) string {
+	sum := sha256.Sum256(src)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+
+	"intermark/go/files"
+	"intermark/go/html"
+	"intermark/go/layout"
+	"intermark/go/paths"
+)
+
+// errorPages are the optional reserved pages in PUB_DIR used for error responses.
+var errorPages = map[int]string{
+	http.StatusNotFound:            ".404.md",
+	http.StatusInternalServerError: ".500.md",
+}
+
+// renderErrorPage renders the reserved page for the given status with the index
+// template, unless front matter sets one. Returns "" if the page doesn't exist.
+func renderErrorPage(status int, tmpls *template.Template, l *layout.Layout, pathToHash map[string]string, debug bool) (string, error) {
+	path := filepath.Join(paths.PUB_DIR, errorPages[status])
+	if exists, err := files.Exists(path); err != nil || !exists {
+		return "", err
+	}
+	fm, err := html.ReadFrontMatter(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl := l.IndexTmpl
+	if fm.Template != "" {
+		tmpl = fm.Template
+	}
+	return layout.Render(path, tmpl, tmpls, l, pathToHash, debug)
+}
+
+// notFound redirects if the path moved, otherwise serves the live generation's
+// 404 page, or a plain one if there is none.
+func (r *Router) notFound(res http.ResponseWriter, req *http.Request) {
+	g := r.gen.Load()
+	if g != nil && redirect(res, req, g.layout) {
+		return
+	}
+	if g == nil || g.notFoundPage == nil {
+		http.NotFound(res, req)
+		return
+	}
+	res.Header().Set("Content-Encoding", "gzip")
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.WriteHeader(http.StatusNotFound)
+	res.Write(g.notFoundPage)
+}
+
+// editError renders the 404 / 500 page on the fly in edit mode, falling back to
+// a plain error with msg if it doesn't exist or fails to render too.
+func (r *Router) editError(res http.ResponseWriter, status int, msg string) {
+	if r.templates != nil {
+		page, err := renderErrorPage(status, r.templates, r.layout, nil, r.debugMode)
+		if err != nil {
+			r.log.Errorf("error rendering %s: %v\n", errorPages[status], err)
+		} else if page != "" {
+			res.Header().Set("Content-Type", "text/html; charset=utf-8")
+			res.WriteHeader(status)
+			res.Write([]byte(page))
+			return
+		}
+	}
+	http.Error(res, msg, status)
+}
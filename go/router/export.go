@@ -0,0 +1,240 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"intermark/go/files"
+	"intermark/go/paths"
+
+	"github.com/Data-Corruption/rlog/logger"
+)
+
+const exportMarker = ".intermark-export" // marks a dir as safe to overwrite
+
+// redirectStub is written in place of redirected pages, args are the target url thrice.
+const redirectStub = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Redirecting</title>
+<link rel="canonical" href="%s"><meta http-equiv="refresh" content="0; url=%s">
+</head><body><a href="%s">Redirecting</a></body></html>
+`
+
+// Export builds the site the same way prod does and writes it to outDir as
+// plain files with the same URLs as prod, i.e. `index.html`, `404.html`,
+// `p/**.html`, `a/<hash>.<ext>`, `f/**.xml`, `search.json`, `search-store.json`,
+// `robots.txt`, and `sitemap.xml`. Each page is also written as
+// `p/**/index.html` so extensionless links work on servers that don't try
+// `.html`. If gz is true, compressible files also get a `.gz` sibling.
+// Redirects are written as meta refresh pages.
+//
+// outDir must be empty, missing, or a previous export.
+func Export(ctx context.Context, outDir string, gz, debug bool) error {
+	r := &Router{
+		ctx:        ctx,
+		log:        logger.FromContext(ctx),
+		debugMode:  debug,
+		distRoot:   paths.EXPORT_DIST_DIR, // don't touch a live server's generations
+		pageCache:  files.NewLRU(false, 0),
+		assetCache: files.NewLRU(false, 0),
+	}
+	defer os.RemoveAll(r.distRoot)
+
+	// prepare out dir
+	if err := prepareExportDir(outDir); err != nil {
+		return err
+	}
+
+	// build
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting current working directory: %w", err)
+	}
+	if err := r.LoadAll(cwd, ""); err != nil {
+		return fmt.Errorf("error loading all: %w", err)
+	}
+	g := r.gen.Load()
+
+	// index, 404, search, robots, sitemap, and feeds
+	if err := writeGunzipped(filepath.Join(outDir, "index.html"), g.indexPage); err != nil {
+		return fmt.Errorf("error writing index page: %w", err)
+	}
+	if err := writeGunzipped(filepath.Join(outDir, "search.json"), g.searchIdx); err != nil {
+		return fmt.Errorf("error writing search index: %w", err)
+	}
+	if err := writeGunzipped(filepath.Join(outDir, "search-store.json"), g.storeIdx); err != nil {
+		return fmt.Errorf("error writing search store: %w", err)
+	}
+	if g.notFoundPage != nil {
+		if err := writeGunzipped(filepath.Join(outDir, "404.html"), g.notFoundPage); err != nil {
+			return fmt.Errorf("error writing 404 page: %w", err)
+		}
+	}
+	if err := writeGunzipped(filepath.Join(outDir, "robots.txt"), g.robots); err != nil {
+		return fmt.Errorf("error writing robots.txt: %w", err)
+	}
+	if g.sitemap != nil {
+		if err := writeGunzipped(filepath.Join(outDir, "sitemap.xml"), g.sitemap); err != nil {
+			return fmt.Errorf("error writing sitemap: %w", err)
+		}
+	}
+
+	for link, data := range g.feeds {
+		if err := os.MkdirAll(filepath.Join(outDir, filepath.Dir(link)), 0o755); err != nil {
+			return err
+		}
+		if err := writeGunzipped(filepath.Join(outDir, link), data); err != nil {
+			return fmt.Errorf("error writing feed %s: %w", link, err)
+		}
+	}
+
+	// pages
+	pageCount := 0
+	aliases := map[string]string{} // "p/foo/index.html" -> "p/foo.html"
+	err = filepath.WalkDir(g.distDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".html") {
+			return err
+		}
+		rel, err := filepath.Rel(g.distDir, path)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join("p", rel)
+		if err := copyFile(path, filepath.Join(outDir, out)); err != nil {
+			return err
+		}
+		aliases[filepath.Join(strings.TrimSuffix(out, ".html"), "index.html")] = out
+		pageCount++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting pages: %w", err)
+	}
+	for alias, page := range aliases {
+		aliasPath := filepath.Join(outDir, alias)
+		if exists, err := files.Exists(aliasPath); err != nil {
+			return err
+		} else if exists {
+			continue // a real page wins
+		}
+		if err := copyFile(filepath.Join(outDir, page), aliasPath); err != nil {
+			return fmt.Errorf("error exporting page alias %s: %w", alias, err)
+		}
+	}
+
+	// redirect stubs, static hosts can't send 301s
+	redirects := 0
+	for from := range g.layout.Redirects {
+		if !strings.HasPrefix(from, "/") || from == "/" {
+			continue
+		}
+		to, _ := g.layout.Redirects.Resolve(from)
+		stub := []byte(fmt.Sprintf(redirectStub, html.EscapeString(to), html.EscapeString(to), html.EscapeString(to)))
+		outs := []string{filepath.Join(from[1:], "index.html")}
+		if strings.HasPrefix(from, "/p/") {
+			outs = append(outs, from[1:]+".html")
+		}
+		for _, out := range outs {
+			outPath := filepath.Join(outDir, filepath.FromSlash(out))
+			if exists, err := files.Exists(outPath); err != nil {
+				return err
+			} else if exists {
+				continue // a real page wins
+			}
+			if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(outPath, stub, 0o644); err != nil {
+				return fmt.Errorf("error writing redirect %s: %w", from, err)
+			}
+		}
+		redirects++
+	}
+
+	// assets
+	for hash, path := range g.assHashToPath {
+		if err := copyFile(path[1:], filepath.Join(outDir, "a", hash)); err != nil { // remove leading "/"
+			return fmt.Errorf("error exporting asset %s: %w", path, err)
+		}
+	}
+
+	// optional .gz siblings
+	if gz {
+		err := filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(path, ".gz") || d.Name() == exportMarker {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if !files.ShouldGzip(files.DetectMimeType(path, data)) {
+				return nil
+			}
+			var b bytes.Buffer
+			w, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+			w.Write(data)
+			w.Close()
+			return os.WriteFile(path+".gz", b.Bytes(), 0o644)
+		})
+		if err != nil {
+			return fmt.Errorf("error compressing export: %w", err)
+		}
+	}
+
+	r.log.Infof("Exported %d pages, %d redirects, and %d assets to %s\n", pageCount, redirects, len(g.assHashToPath), outDir)
+	return nil
+}
+
+// prepareExportDir ensures outDir is an empty dir, clearing a previous export if needed.
+func prepareExportDir(outDir string) error {
+	entries, err := os.ReadDir(outDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading export directory: %w", err)
+	}
+	if len(entries) > 0 {
+		if exists, err := files.Exists(filepath.Join(outDir, exportMarker)); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("export directory %s is not empty and not a previous export", outDir)
+		}
+		if err := os.RemoveAll(outDir); err != nil {
+			return fmt.Errorf("error clearing previous export: %w", err)
+		}
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("error creating export directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(outDir, exportMarker), nil, 0o644)
+}
+
+func writeGunzipped(path string, data []byte) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
@@ -0,0 +1,219 @@
+package router
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"intermark/go/env"
+	"intermark/go/html"
+	"intermark/go/layout"
+	"intermark/go/paths"
+	"intermark/go/sins"
+)
+
+const (
+	maxFeedEntries = 50  // newest entries kept per feed
+	maxFeedSummary = 160 // runes, for generated summaries
+)
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Link      atomLink    `xml:"link"`
+	Summary   string      `xml:"summary,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// feedEntry is a page in a feed folder, shared by the Atom and RSS encoders.
+type feedEntry struct {
+	title, summary, link, content string
+	published, updated            time.Time
+}
+
+// genFeeds builds Atom and RSS feeds for every folder flagged as a feed, from
+// the pages already written to g.distDir. Published dates come from the "date"
+// front matter key, updated dates from git, each falling back to the other.
+// Feeds need absolute urls, so they're skipped if IM_BASE_URL is not set.
+func (r *Router) genFeeds(g *generation, modTimes map[string]time.Time) error {
+	folders := g.layout.Feeds()
+	if len(folders) == 0 {
+		return nil
+	}
+	base := strings.TrimSuffix(env.Get(env.IM_BASE_URL), "/")
+	if base == "" {
+		r.log.Warnf("IM_BASE_URL is not set, skipping %d feeds\n", len(folders))
+		return nil
+	}
+	now := time.Now()
+
+	for _, folder := range folders {
+		// collect entries
+		entries := []feedEntry{}
+		err := walkItems(folder.Children, func(si *layout.SidebarItem) error {
+			if si.Type != "file" || si.Draft {
+				return nil
+			}
+			data, err := os.ReadFile(g.distPath(si.Path))
+			if err != nil {
+				return fmt.Errorf("error reading page %s: %w", si.Path, err)
+			}
+			content, err := html.ContentHTML(data, base)
+			if err != nil {
+				return fmt.Errorf("error extracting content of %s: %w", si.Path, err)
+			}
+			fm, err := html.ReadFrontMatter(filepath.Join(paths.PUB_DIR, si.Path))
+			if err != nil {
+				return fmt.Errorf("error reading front matter %s: %w", si.Path, err)
+			}
+			e := feedEntry{title: fm.Title, summary: fm.Description, link: base + si.Link, content: content}
+			if e.title == "" || e.summary == "" {
+				title, desc, err := html.Summary([]byte(content), maxFeedSummary)
+				if err != nil {
+					return fmt.Errorf("error summarizing %s: %w", si.Path, err)
+				}
+				e.title = sins.Ternary(e.title == "", title, e.title)
+				e.summary = sins.Ternary(e.summary == "", desc, e.summary)
+			}
+			if e.title == "" {
+				e.title = si.Label
+			}
+			// dates
+			e.published, e.updated = fm.Date, modTimes[si.Path]
+			if e.updated.IsZero() {
+				e.updated = now // uncommitted
+			}
+			if e.published.IsZero() {
+				e.published = e.updated
+			}
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error building feed for %s: %w", folder.Path, err)
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].published.After(entries[j].published) })
+		if len(entries) > maxFeedEntries {
+			entries = entries[:maxFeedEntries]
+		}
+		updated := now
+		if len(entries) > 0 {
+			updated = entries[0].updated
+			for _, e := range entries {
+				if e.updated.After(updated) {
+					updated = e.updated
+				}
+			}
+		}
+
+		// encode
+		title := folder.Label + " | " + g.layout.Title
+		atom := atomFeed{
+			XMLNS:   "http://www.w3.org/2005/Atom",
+			ID:      base + folder.FeedLink("atom"),
+			Title:   title,
+			Updated: updated.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: base + folder.FeedLink("atom"), Rel: "self", Type: "application/atom+xml"},
+				{Href: base + "/", Rel: "alternate", Type: "text/html"},
+			},
+		}
+		rss := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title:         title,
+			Link:          base + "/",
+			Description:   title,
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+		}}
+		for _, e := range entries {
+			atom.Entries = append(atom.Entries, atomEntry{
+				ID:        e.link,
+				Title:     e.title,
+				Updated:   e.updated.UTC().Format(time.RFC3339),
+				Published: e.published.UTC().Format(time.RFC3339),
+				Link:      atomLink{Href: e.link, Rel: "alternate", Type: "text/html"},
+				Summary:   e.summary,
+				Content:   atomContent{Type: "html", Body: e.content},
+			})
+			rss.Channel.Items = append(rss.Channel.Items, rssItem{
+				Title:       e.title,
+				Link:        e.link,
+				GUID:        e.link,
+				PubDate:     e.published.UTC().Format(time.RFC1123Z),
+				Description: e.content,
+			})
+		}
+		for kind, feed := range map[string]any{"atom": atom, "rss": rss} {
+			data, err := xml.MarshalIndent(feed, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding %s feed for %s: %w", kind, folder.Path, err)
+			}
+			if g.feeds[folder.FeedLink(kind)], err = gzipBytes(append([]byte(xml.Header), data...)); err != nil {
+				return fmt.Errorf("error compressing %s feed for %s: %w", kind, folder.Path, err)
+			}
+		}
+		r.log.Debugf("Generated feeds for %s with %d entries\n", folder.Path, len(entries))
+	}
+	return nil
+}
+
+// walkItems calls f for every item in items and their children.
+func walkItems(items []*layout.SidebarItem, f func(*layout.SidebarItem) error) error {
+	for _, si := range items {
+		if err := f(si); err != nil {
+			return err
+		}
+		if err := walkItems(si.Children, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"intermark/go/layout"
+	"intermark/go/system/lunrjs"
+)
+
+// generation is everything prod serves that gets rebuilt on update. LoadAll
+// builds a complete one off to the side, then the router swaps it in with a
+// single atomic store so readers never see a half built site.
+type generation struct {
+	seq           int                // used to name distDir
+	distDir       string             // e.g. "public/.meta/dist/3"
+	templates     *template.Template // templates used for this generation
+	layout        *layout.Layout     // layout used for this generation
+	searchHash    string             // lunrjs index hash
+	searchIdx     []byte             // lunrjs index
+	search        *lunrjs.Index      // same index, for /api/search
+	storeHash     string             // search text store hash
+	storeIdx      []byte             // search text store, doc id -> body text
+	indexPage     []byte             // gzipped index page
+	notFoundPage  []byte             // gzipped 404 page, nil if there is no .404.md
+	sitemap       []byte             // gzipped sitemap.xml, nil if IM_BASE_URL is not set
+	robots        []byte             // gzipped robots.txt
+	feeds         map[string][]byte  // "/f/changelog/atom.xml" -> gzipped feed
+	assHashToPath map[string]string  // "hash.ext" -> "/assets/example.ext"
+	assPathToHash map[string]string  // "/assets/example.ext" -> "hash.ext"
+}
+
+func newGeneration(root string, seq int) *generation {
+	return &generation{
+		seq:           seq,
+		distDir:       filepath.Join(root, strconv.Itoa(seq)),
+		layout:        &layout.Layout{},
+		assHashToPath: make(map[string]string),
+		assPathToHash: make(map[string]string),
+		feeds:         make(map[string][]byte),
+	}
+}
+
+// distPath returns where the page for the given PUB_DIR relative path is written.
+func (g *generation) distPath(path string) string {
+	outPath := filepath.Join(g.distDir, path)
+	// strip extension, add .html
+	if strings.HasSuffix(outPath, ".md") {
+		outPath = outPath[:len(outPath)-3] + ".html"
+	}
+	return outPath
+}
+
+// pruneGenerations removes every generation dir in root except the live one.
+// Called before building a new generation rather than right after the swap, so
+// requests still holding the previous generation can finish reading from it.
+func pruneGenerations(root string, live *generation) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading dist directory: %w", err)
+	}
+	for _, e := range entries {
+		if live != nil && e.Name() == strconv.Itoa(live.seq) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+			return fmt.Errorf("error removing old generation %s: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
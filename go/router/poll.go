@@ -0,0 +1,96 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"intermark/go/env"
+	"intermark/go/system/git"
+)
+
+// startPoller starts polling the content remote every IM_POLL_M minutes, for
+// hosts CI can't reach. Does nothing if IM_POLL_M is 0.
+func (r *Router) startPoller() {
+	m, err := strconv.ParseUint(env.Get(env.IM_POLL_M), 10, 64)
+	if err != nil {
+		r.log.Warnf("Invalid IM_POLL_M %q, polling disabled\n", env.Get(env.IM_POLL_M))
+		return
+	}
+	if m == 0 {
+		return
+	}
+	r.log.Infof("Polling for content updates every %d minutes\n", m)
+	go func() {
+		ticker := time.NewTicker(time.Duration(m) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.poll(); err != nil {
+					r.log.Errorf("Error polling for updates: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// poll fetches the content branch and requests an update if the remote moved.
+// Holds the update flag while fetching so it can't overlap a running update.
+func (r *Router) poll() error {
+	if err := r.SetUpdating(); err != nil {
+		r.log.Debugf("Skipping poll, update in progress\n")
+		return nil
+	}
+	moved, err := r.remoteMoved()
+	r.ClearUpdating()
+	if err != nil {
+		return err
+	}
+	if moved {
+		r.RequestUpdate()
+	}
+	return nil
+}
+
+// remoteMoved fetches and reports whether the remote branch differs from HEAD.
+// A remote commit that already failed and was rolled back doesn't count.
+func (r *Router) remoteMoved() (bool, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false, fmt.Errorf("error getting current working directory: %w", err)
+	}
+	remote, branch := env.Get(env.IM_GIT_REMOTE), env.Get(env.IM_GIT_BRANCH)
+
+	// fetch
+	fCtx, fCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_GIT_M))
+	defer fCancel()
+	if err := git.Fetch(fCtx, cwd, remote, branch); err != nil {
+		return false, fmt.Errorf("error fetching latest changes: %w", err)
+	}
+
+	// compare
+	cCtx, cCancel := context.WithTimeout(r.ctx, 10*time.Second)
+	defer cCancel()
+	head, err := git.GetCommitHash(cCtx, cwd)
+	if err != nil {
+		return false, fmt.Errorf("error getting commit hash: %w", err)
+	}
+	remoteHead, err := git.GetRemoteCommitHash(cCtx, cwd, remote, branch)
+	if err != nil {
+		return false, fmt.Errorf("error getting remote commit hash: %w", err)
+	}
+	if head == remoteHead {
+		return false, nil
+	}
+	if f := r.LastFailure(); f != nil && f.Commit == remoteHead {
+		r.log.Debugf("Remote is at %s which already failed, waiting for a new commit\n", remoteHead)
+		return false, nil
+	}
+	r.log.Infof("Remote moved from %s to %s, updating\n", head, remoteHead)
+	return true, nil
+}
@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -23,6 +24,7 @@ import (
 	"intermark/go/sins"
 	"intermark/go/system/git"
 	"intermark/go/system/lunrjs"
+	"intermark/go/templates"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/minio/sha256-simd"
@@ -34,28 +36,47 @@ func (r *Router) setupProdRoutes() error {
 	if err != nil {
 		return fmt.Errorf("error getting current working directory: %w", err)
 	}
+	// load update history
+	if err := r.status.load(); err != nil {
+		return fmt.Errorf("error loading update history: %w", err)
+	}
+
+	// get commit hash, becomes the first known-good commit for rollbacks
+	cCtx, cCancel := context.WithTimeout(r.ctx, 10*time.Second)
+	defer cCancel()
+	commit, err := git.GetCommitHash(cCtx, cwd)
+	if err != nil {
+		return fmt.Errorf("error getting commit hash: %w", err)
+	}
+
 	// load all
-	if err := r.LoadAll(cwd, ""); err != nil {
+	if err := r.LoadAll(cwd, commit); err != nil {
 		return fmt.Errorf("error loading all: %w", err)
 	}
+	r.status.end("", nil) // the first load isn't an update, back to idle
+
+	// unknown routes
+	r.Router.NotFound(r.notFound)
 
 	// serve landing page
 	r.Router.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		g := r.gen.Load()
 		res.Header().Set("Content-Encoding", "gzip")
 		res.Header().Set("Content-Type", "text/html; charset=utf-8")
-		res.Write(r.indexPage)
+		res.Write(g.indexPage)
 	})
 
 	// serve pages
 	r.Router.Get("/p/*", func(res http.ResponseWriter, req *http.Request) {
-		path := filepath.Join(paths.DIST_DIR, filepath.Clean(req.URL.Path[3:]))
+		g := r.gen.Load()
+		path := filepath.Join(g.distDir, filepath.Clean(req.URL.Path[3:]))
 		if !strings.HasSuffix(path, ".html") {
 			path += ".html"
 		}
 		data, _, zipped, err := r.pageCache.Read(path)
 		if err != nil {
 			r.log.Errorf("error reading page %s: %v\n", path, err)
-			http.NotFound(res, req)
+			r.notFound(res, req)
 			return
 		}
 		if zipped {
@@ -67,17 +88,18 @@ func (r *Router) setupProdRoutes() error {
 
 	// prod assets
 	r.Router.Get("/a/{name}", func(res http.ResponseWriter, req *http.Request) {
+		g := r.gen.Load()
 		name := chi.URLParam(req, "name")
-		if path, ok := r.assHashToPath[name]; !ok {
+		if path, ok := g.assHashToPath[name]; !ok {
 			r.log.Debugf("Asset %s not found\n", name)
-			http.NotFound(res, req)
+			r.notFound(res, req)
 			return
 		} else {
 			r.log.Debugf("Serving asset %s from %s\n", name, path)
 			data, mime, zipped, err := r.assetCache.Read(path[1:]) // remove leading "/"
 			if err != nil {
 				r.log.Errorf("Error reading asset %s: %v\n", path, err)
-				http.NotFound(res, req)
+				r.notFound(res, req)
 				return
 			}
 			if zipped {
@@ -89,25 +111,60 @@ func (r *Router) setupProdRoutes() error {
 		}
 	})
 
-	// search index
+	// search index and text store
 	r.Router.Get("/search.json", func(res http.ResponseWriter, req *http.Request) {
-		if match := req.Header.Get("If-None-Match"); match == r.searchHash {
-			r.log.Debugf("Search index not modified, sending 304\n")
-			res.Header().Set("ETag", match)
-			res.WriteHeader(http.StatusNotModified)
+		g := r.gen.Load()
+		r.serveSearchFile(res, req, g.searchIdx, g.searchHash)
+	})
+	r.Router.Get("/search-store.json", func(res http.ResponseWriter, req *http.Request) {
+		g := r.gen.Load()
+		r.serveSearchFile(res, req, g.storeIdx, g.storeHash)
+	})
+
+	r.Router.Get("/api/search", r.searchAPI)
+
+	// sitemap and robots, sitemap is nil without IM_BASE_URL
+	r.Router.Get("/sitemap.xml", func(res http.ResponseWriter, req *http.Request) {
+		g := r.gen.Load()
+		if g.sitemap == nil {
+			r.notFound(res, req)
 			return
 		}
-		res.Header().Set("ETag", r.searchHash)
 		res.Header().Set("Content-Encoding", "gzip")
-		res.Header().Set("Content-Type", "application/json")
-		res.Write(r.searchIdx)
+		res.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		res.Write(g.sitemap)
+	})
+	r.Router.Get("/robots.txt", func(res http.ResponseWriter, req *http.Request) {
+		g := r.gen.Load()
+		res.Header().Set("Content-Encoding", "gzip")
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		res.Write(g.robots)
+	})
+
+	// feeds
+	r.Router.Get("/f/*", func(res http.ResponseWriter, req *http.Request) {
+		g := r.gen.Load()
+		data, ok := g.feeds[req.URL.Path]
+		if !ok {
+			r.notFound(res, req)
+			return
+		}
+		res.Header().Set("Content-Encoding", "gzip")
+		res.Header().Set("Content-Type", sins.Ternary(strings.HasSuffix(req.URL.Path, "/atom.xml"), "application/atom+xml", "application/rss+xml")+"; charset=utf-8")
+		res.Write(data)
 	})
 
-	// update from content repo action
+	// update status and history
+	r.setupStatusRoute()
+
+	// optional remote polling
+	r.startPoller()
+
+	// update from content repo action or push webhook
 	r.Router.Post("/update", func(res http.ResponseWriter, req *http.Request) {
-		body, err := io.ReadAll(req.Body)
+		body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxUpdateBody))
 		if err != nil {
-			http.Error(res, "Error reading request body", http.StatusInternalServerError)
+			http.Error(res, "Error reading request body", http.StatusBadRequest)
 			return
 		}
 		// get token from env
@@ -116,16 +173,27 @@ func (r *Router) setupProdRoutes() error {
 			http.Error(res, "Update token not set", http.StatusInternalServerError)
 			return
 		}
-		// check token
-		if string(body) != token {
-			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+		// check token / signature
+		branch := env.Get(env.IM_GIT_BRANCH)
+		push, err := checkUpdateRequest(req, body, token, branch)
+		if err != nil {
+			if errors.Is(err, errUnauthorized) {
+				http.Error(res, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			r.log.Warnf("Bad update request: %v\n", err)
+			http.Error(res, "Bad request", http.StatusBadRequest)
 			return
 		}
-		if err := r.Update(); err != nil {
-			r.log.Errorf("Error updating: %v\n", err)
-			http.Error(res, "Error updating", http.StatusInternalServerError)
+		if !push {
+			r.log.Debugf("Ignoring webhook, not a push to %s\n", branch)
+			res.Write([]byte("Ignored, not a push to " + branch))
 			return
 		}
+		r.RequestUpdate()
+		res.Header().Set("Location", "/update/status")
+		res.WriteHeader(http.StatusAccepted)
+		res.Write([]byte("Update queued"))
 	})
 
 	return nil
@@ -135,11 +203,13 @@ func (r *Router) IsUpdating() bool {
 	return r.updateFlag.Load()
 }
 
+var errUpdateInProgress = errors.New("update already in progress")
+
 func (r *Router) SetUpdating() error {
 	if r.updateFlag.CompareAndSwap(false, true) {
 		return nil
 	}
-	return fmt.Errorf("update already in progress")
+	return errUpdateInProgress
 }
 
 func (r *Router) ClearUpdating() {
@@ -149,6 +219,49 @@ func (r *Router) ClearUpdating() {
 	r.log.Warnf("update flag already cleared")
 }
 
+// RequestUpdate runs Update in the background. Requests that arrive while an
+// update is running are coalesced into exactly one follow-up run, so the
+// latest push is always deployed.
+func (r *Router) RequestUpdate() {
+	r.updatePending.Store(true)
+	if !r.updateLoop.CompareAndSwap(false, true) {
+		return // running loop will pick it up
+	}
+	go func() {
+		for {
+			for r.updatePending.Swap(false) {
+				if err := r.Update(); errors.Is(err, errUpdateInProgress) {
+					// a poll is holding the flag, try again shortly
+					r.updatePending.Store(true)
+					time.Sleep(time.Second)
+				} else if err != nil {
+					r.log.Errorf("Error updating: %v\n", err)
+				}
+			}
+			r.updateLoop.Store(false)
+			// a request may have landed between the last swap and clearing the loop flag
+			if !r.updatePending.Load() || !r.updateLoop.CompareAndSwap(false, true) {
+				return
+			}
+		}
+	}()
+}
+
+// UpdateFailure records a commit that failed to deploy and was rolled back.
+type UpdateFailure struct {
+	Commit string    `json:"commit"` // may be empty if the failure happened before HEAD could be read
+	Err    string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// LastFailure returns the most recent failed update, or nil if there hasn't been one.
+func (r *Router) LastFailure() *UpdateFailure {
+	return r.lastFailure.Load()
+}
+
+// Update fetches and resets to the latest content, then loads it. If anything
+// after the reset fails, the repo is reset back to the last known-good commit
+// (DIST_CM_KEY) and that is loaded again. Progress is tracked in the update status.
 func (r *Router) Update() error {
 	// set updating flag
 	if err := r.SetUpdating(); err != nil {
@@ -156,50 +269,101 @@ func (r *Router) Update() error {
 	}
 	defer r.ClearUpdating()
 
+	r.status.begin()
+	commit, err := r.update()
+	if sErr := r.status.end(commit, err); sErr != nil {
+		r.log.Errorf("error saving update history: %v\n", sErr)
+	}
+	return err
+}
+
+// update does the work for Update, returning the commit it attempted.
+func (r *Router) update() (string, error) {
 	// get cwd
 	cwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("error getting current working directory: %w", err)
+		return "", fmt.Errorf("error getting current working directory: %w", err)
 	}
 
+	goodCommit := os.Getenv(DIST_CM_KEY)
+	remote, branch := env.Get(env.IM_GIT_REMOTE), env.Get(env.IM_GIT_BRANCH)
+
 	// fetch
+	r.status.setPhase(PhaseFetch)
 	fCtx, fCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_GIT_M))
 	defer fCancel()
-	if err := git.Fetch(fCtx, cwd, "main"); err != nil {
-		return fmt.Errorf("error fetching latest changes: %w", err)
+	if err := git.Fetch(fCtx, cwd, remote, branch); err != nil {
+		return "", fmt.Errorf("error fetching latest changes: %w", err)
 	}
 
 	// reset
+	r.status.setPhase(PhaseReset)
 	rCtx, rCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_GIT_M))
 	defer rCancel()
-	if err := git.Reset(rCtx, cwd, "main", true); err != nil {
-		return fmt.Errorf("error resetting to latest changes: %w", err)
+	if err := git.Reset(rCtx, cwd, remote, branch, true); err != nil {
+		return "", fmt.Errorf("error resetting to latest changes: %w", err)
 	}
 
-	// lsf pull
-	lCtx, lCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_LFS_M))
-	defer lCancel()
-	if err := git.LfsPull(lCtx, cwd); err != nil {
-		return fmt.Errorf("error pulling LFS files: %w", err)
+	// load, rolling back on failure
+	newCommit, err := r.loadHead(cwd)
+	if err == nil {
+		return newCommit, nil
+	}
+	r.lastFailure.Store(&UpdateFailure{Commit: newCommit, Err: err.Error(), Time: time.Now()})
+	r.log.Errorf("Update to commit %q failed, rolling back to %q: %v\n", newCommit, goodCommit, err)
+	if rbErr := r.rollback(cwd, goodCommit); rbErr != nil {
+		return newCommit, fmt.Errorf("error loading commit %q: %w, rollback also failed: %v", newCommit, err, rbErr)
 	}
+	return newCommit, fmt.Errorf("error loading commit %q, rolled back to %q: %w", newCommit, goodCommit, err)
+}
 
+// loadHead pulls LFS files and loads the current HEAD, returning its hash.
+func (r *Router) loadHead(cwd string) (string, error) {
 	// get commit hash
 	cCtx, cCancel := context.WithTimeout(r.ctx, 10*time.Second)
 	defer cCancel()
-	var newCommit string
-	if newCommit, err = git.GetCommitHash(cCtx, cwd); err != nil {
-		return fmt.Errorf("error getting commit hash: %w", err)
+	commit, err := git.GetCommitHash(cCtx, cwd)
+	if err != nil {
+		return "", fmt.Errorf("error getting commit hash: %w", err)
+	}
+
+	// lfs pull
+	r.status.setPhase(PhaseLFS)
+	lCtx, lCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_LFS_M))
+	defer lCancel()
+	if err := git.LfsPull(lCtx, cwd); err != nil {
+		return commit, fmt.Errorf("error pulling LFS files: %w", err)
 	}
 
 	// load all
-	if err := r.LoadAll(cwd, newCommit); err != nil {
-		return fmt.Errorf("error loading all: %w", err)
+	if err := r.LoadAll(cwd, commit); err != nil {
+		return commit, fmt.Errorf("error loading all: %w", err)
 	}
 
+	return commit, nil
+}
+
+// rollback resets the repo to the given known-good commit and loads it again.
+// The live generation is untouched until that load succeeds.
+func (r *Router) rollback(cwd, commit string) error {
+	if commit == "" {
+		return fmt.Errorf("no known-good commit to roll back to")
+	}
+	r.status.setPhase(PhaseRollback)
+	rCtx, rCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_GIT_M))
+	defer rCancel()
+	if err := git.ResetTo(rCtx, cwd, commit, true); err != nil {
+		return fmt.Errorf("error resetting to %s: %w", commit, err)
+	}
+	if _, err := r.loadHead(cwd); err != nil {
+		return err
+	}
+	r.log.Infof("Rolled back to commit %s\n", commit)
 	return nil
 }
 
-// LoadAll loads all templates, assets, etc.
+// LoadAll builds a new generation (templates, layout, assets, dist, search)
+// and swaps it in once complete. The live generation keeps serving until then.
 // If env commit / newCommit are provided and not the first LoadAll of the
 // process, it will only do work for changed files.
 func (r *Router) LoadAll(cwd, newCommit string) error {
@@ -207,22 +371,51 @@ func (r *Router) LoadAll(cwd, newCommit string) error {
 	// get last commit hash
 	distCommit := os.Getenv(DIST_CM_KEY)
 
+	// remove stale generations and create the new one
+	old := r.gen.Load()
+	if err := pruneGenerations(r.distRoot, old); err != nil {
+		return err
+	}
+	r.genSeq++
+	g := newGeneration(r.distRoot, r.genSeq)
+	if err := os.MkdirAll(g.distDir, 0o755); err != nil {
+		return fmt.Errorf("error creating generation directory %s: %w", g.distDir, err)
+	}
+
 	// register assets
-	if err := r.registerAssets(cwd, distCommit); err != nil {
+	r.status.setPhase(PhaseAssets)
+	if err := r.registerAssets(g, old, cwd, distCommit); err != nil {
 		return fmt.Errorf("error registering assets: %w", err)
 	}
 
-	// load templates, layout, and run Tailwind
-	if err := r.refresh(); err != nil {
+	// run Tailwind
+	r.status.setPhase(PhaseTailwind)
+	if err := r.runTailwind(g); err != nil {
+		return err
+	}
+
+	// load templates and layout
+	r.status.setPhase(PhaseDist)
+	if distCommit != "" {
+		if err := r.recordRenames(cwd, distCommit); err != nil {
+			r.log.Warnf("Error recording renames, old urls of moved pages won't redirect: %v\n", err)
+		}
+	}
+	var err error
+	if g.templates, err = templates.LoadTemplates(r.ctx); err != nil {
+		return fmt.Errorf("error loading templates: %w", err)
+	}
+	if err := g.layout.FromFile(r.ctx); err != nil {
 		return err
 	}
 
-	// generate dist from public
-	if err := r.genDist(); err != nil {
+	// generate dist from public, includes search
+	if err := r.genDist(g, cwd); err != nil {
 		return fmt.Errorf("error generating dist: %w", err)
 	}
 
-	// clear cache
+	// swap in the new generation, then clear cache
+	r.gen.Store(g)
 	r.pageCache.Reset()
 	r.assetCache.Reset()
 
@@ -241,21 +434,22 @@ func (r *Router) LoadAll(cwd, newCommit string) error {
 	return nil
 }
 
-func (r *Router) registerAssets(cwd, lastCommit string) error {
+// registerAssets hashes assets into g. Unchanged assets are copied from old if given.
+func (r *Router) registerAssets(g, old *generation, cwd, lastCommit string) error {
 	htp := sync.Map{}
 	pth := sync.Map{}
-	r.log.Debugf("htp len: %d", len(r.assHashToPath))
 	errs, err := files.WalkCon(paths.ASS_DIR, 8, func(path string) error { // path will be `assets/example.thing`
 		// asset skip check
 		ctx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
 		defer cancel()
+		aPath := "/" + filepath.ToSlash(filepath.Clean(path))
 		if changed, err := git.LFSFileChanged(ctx, cwd, path, lastCommit); err != nil {
 			return err
-		} else if !changed {
+		} else if !changed && old != nil {
 			// get from old, copy to new, avoid hashing
-			if old_aPath, ok := r.assPathToHash[path]; ok {
-				htp.Store(old_aPath, path)
-				pth.Store(path, old_aPath)
+			if oldHash, ok := old.assPathToHash[aPath]; ok {
+				htp.Store(oldHash, aPath)
+				pth.Store(aPath, oldHash)
 				return nil
 			}
 		}
@@ -266,12 +460,10 @@ func (r *Router) registerAssets(cwd, lastCommit string) error {
 		}
 		// hash and add to temp maps
 		sum := sha256.Sum256(data)
-		hash := hex.EncodeToString(sum[:])
-		aPath := hash + filepath.Ext(path)
-		path = "/" + filepath.ToSlash(filepath.Clean(path))
-		htp.Store(aPath, path)
-		pth.Store(path, aPath)
-		r.log.Debugf("aPath: %s, path: %s\n", aPath, path)
+		hash := hex.EncodeToString(sum[:]) + filepath.Ext(path)
+		htp.Store(hash, aPath)
+		pth.Store(aPath, hash)
+		r.log.Debugf("hash: %s, path: %s\n", hash, aPath)
 		return nil
 	})
 	if err != nil {
@@ -283,51 +475,46 @@ func (r *Router) registerAssets(cwd, lastCommit string) error {
 		}
 		return fmt.Errorf("%d errors registering assets, see logs for details", len(errs))
 	}
-	// reset the real maps
-	r.assHashToPath = make(map[string]string)
-	r.assPathToHash = make(map[string]string)
 	// copy from the temporary sync.Maps
 	htp.Range(func(key, value any) bool {
-		hash := key.(string)
-		path := value.(string)
-		r.assHashToPath[hash] = path
+		g.assHashToPath[key.(string)] = value.(string)
 		return true
 	})
 	pth.Range(func(key, value any) bool {
-		path := key.(string)
-		hash := value.(string)
-		r.assPathToHash[path] = hash
+		g.assPathToHash[key.(string)] = value.(string)
 		return true
 	})
+	r.log.Debugf("registered %d assets", len(g.assHashToPath))
 	return nil
 }
 
-func (r *Router) genDist() error {
-	// clear dist dir
-	if err := os.RemoveAll(paths.DIST_DIR); err != nil {
-		return fmt.Errorf("error removing dist directory: %w", err)
-	}
-
+func (r *Router) genDist(g *generation, cwd string) error {
 	// gen index
-	indexPage, err := layout.Render(filepath.Join(paths.PUB_DIR, ".index.md"), r.layout.IndexTmpl, r.templates, r.layout, r.assPathToHash, r.debugMode)
+	indexPage, index, err := layout.RenderPage(filepath.Join(paths.PUB_DIR, ".index.md"), g.layout.IndexTmpl, g.templates, g.layout, g.assPathToHash, r.debugMode)
 	if err != nil {
 		return fmt.Errorf("error processing index file: %w", err)
 	}
 	// compress index page
-	var b bytes.Buffer
-	gz := gzip.NewWriter(&b)
-	_, err = gz.Write([]byte(indexPage))
-	if err != nil {
+	if g.indexPage, err = gzipBytes([]byte(indexPage)); err != nil {
 		return fmt.Errorf("error writing to gzip buffer: %w", err)
 	}
-	gz.Close()
-	r.indexPage = b.Bytes()
-	r.log.Debugf("Generated index page. Before gzip: %d bytes, after gzip: %d bytes\n", len(indexPage), len(r.indexPage))
+	r.log.Debugf("Generated index page. Before gzip: %d bytes, after gzip: %d bytes\n", len(indexPage), len(g.indexPage))
+
+	// gen 404 page, optional
+	notFoundPage, err := renderErrorPage(http.StatusNotFound, g.templates, g.layout, g.assPathToHash, r.debugMode)
+	if err != nil {
+		return fmt.Errorf("error processing 404 file: %w", err)
+	}
+	if notFoundPage != "" {
+		if g.notFoundPage, err = gzipBytes([]byte(notFoundPage)); err != nil {
+			return fmt.Errorf("error writing to gzip buffer: %w", err)
+		}
+	}
 
 	docs := []html.Doc{}
 
 	// extract docs from index page
-	if err := html.ExtractDocs("/", []byte(indexPage), &docs, sins.Ternary(r.debugMode, r.log, nil)); err != nil {
+	if err := html.ExtractDocs("/", index.Title, []byte(indexPage), &docs, sins.Ternary(r.debugMode, r.log, nil)); err != nil {
 		return fmt.Errorf("error extracting docs from index page: %w", err)
 	}
 
@@ -335,22 +522,18 @@ func (r *Router) genDist() error {
 	errors := []error{}
 	visitedItems := 0
 	writeCount := 0
-	r.layout.Walk(func(si *layout.SidebarItem) (bool, error) {
+	g.layout.Walk(func(si *layout.SidebarItem) (bool, error) {
 		visitedItems++
-		if si.Type != "file" {
+		if si.Type != "file" || si.Draft {
 			return false, nil
 		}
-		data, err := si.Render(r.templates, r.layout, r.assPathToHash, r.debugMode)
+		data, page, err := si.RenderPage(g.templates, g.layout, g.assPathToHash, r.debugMode)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("error executing template: %w", err))
 			return false, nil
 		}
 		// store in dist
-		outPath := filepath.Join(paths.DIST_DIR, si.Path)
-		// strip extension, add .html
-		if strings.HasSuffix(outPath, ".md") {
-			outPath = outPath[:len(outPath)-3] + ".html"
-		}
+		outPath := g.distPath(si.Path)
 		// ensure parent dir exists
 		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
 			errors = append(errors, fmt.Errorf("error creating dist directory %s: %w", outPath, err))
@@ -361,11 +544,21 @@ func (r *Router) genDist() error {
 			errors = append(errors, fmt.Errorf("error writing file %s: %w", outPath, err))
 			return false, nil
 		}
-		// add to search
-		if err := html.ExtractDocs(si.Path, []byte(data), &docs, sins.Ternary(r.debugMode, r.log, nil)); err != nil {
+		// add to search, with the section and tags for facets
+		first := len(docs)
+		// title for breadcrumbs: front matter, else the first h1, else the sidebar label
+		title := sins.Ternary(page.Title != "", page.Title, si.Label)
+		if err := html.ExtractDocs(si.Path, title, []byte(data), &docs, sins.Ternary(r.debugMode, r.log, nil)); err != nil {
 			errors = append(errors, fmt.Errorf("error extracting docs from %s: %w", si.Path, err))
 			return false, nil
 		}
+		section := g.layout.Section(si.Path)
+		for i := first; i < len(docs); i++ {
+			if section != nil {
+				docs[i].Section, docs[i].SectionLabel = section.Path, section.Label
+			}
+			docs[i].Tags = si.Tags
+		}
 		writeCount++
 		r.log.Debugf("Generated file %s, size: %d\n", outPath, len(data))
 		return false, nil
@@ -380,11 +573,27 @@ func (r *Router) genDist() error {
 	}
 
 	// run lunrjs to generate search index
+	r.status.setPhase(PhaseSearch)
 	lCtx, lCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_LUNR_M))
 	defer lCancel()
-	if r.searchIdx, r.searchHash, err = lunrjs.Run(lCtx, &docs); err != nil {
+	if g.search, g.searchIdx, g.searchHash, err = lunrjs.Run(lCtx, &docs); err != nil {
 		return fmt.Errorf("error running lunrjs: %w", err)
 	}
+	if g.storeIdx, g.storeHash, err = lunrjs.Store(docs); err != nil {
+		return err
+	}
+
+	// sitemap, robots, and feeds
+	modTimes := r.lastModified(cwd)
+	if err := r.genSitemap(g, modTimes); err != nil {
+		return err
+	}
+	if err := r.genRobots(g); err != nil {
+		return err
+	}
+	if err := r.genFeeds(g, modTimes); err != nil {
+		return err
+	}
 
 	// log results
 	r.log.Debugf("Visited %d items, wrote %d files\n", visitedItems, writeCount)
@@ -398,6 +607,33 @@ func (r *Router) genDist() error {
 	return nil
 }
 
+// serveSearchFile writes gzipped JSON with its hash as the ETag, or a 304 if the client has it.
+func (r *Router) serveSearchFile(res http.ResponseWriter, req *http.Request, data []byte, hash string) {
+	if match := req.Header.Get("If-None-Match"); match == hash {
+		r.log.Debugf("%s not modified, sending 304\n", req.URL.Path)
+		res.Header().Set("ETag", match)
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+	res.Header().Set("ETag", hash)
+	res.Header().Set("Content-Encoding", "gzip")
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(data)
+}
+
+// gzipBytes compresses data for serving with Content-Encoding: gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 func getTimeout(s string) time.Duration {
 	m, err := strconv.ParseUint(env.Get(s), 10, 64)
 	if err != nil {
@@ -0,0 +1,55 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"intermark/go/env"
+	"intermark/go/layout"
+	"intermark/go/paths"
+	"intermark/go/system/git"
+)
+
+// recordRenames adds pages renamed since the given commit to paths.RENAMES, so
+// their old URLs keep working. Must run before the layout is loaded.
+func (r *Router) recordRenames(cwd, since string) error {
+	ctx, cancel := context.WithTimeout(r.ctx, getTimeout(env.IM_GIT_M))
+	defer cancel()
+	renames, err := git.Renames(ctx, cwd, since, "HEAD", paths.PUB_DIR)
+	if err != nil {
+		return err
+	}
+	if len(renames) == 0 {
+		return nil
+	}
+	rel := make(map[string]string, len(renames))
+	for from, to := range renames {
+		rel[strings.TrimPrefix(from, paths.PUB_DIR+"/")] = strings.TrimPrefix(to, paths.PUB_DIR+"/")
+	}
+	rd, err := layout.LoadRedirects(paths.RENAMES)
+	if err != nil {
+		return fmt.Errorf("error loading renames: %w", err)
+	}
+	rd.AddRenames(rel)
+	r.log.Infof("Detected %d renamed files since %s\n", len(rel), since)
+	return rd.Save(paths.RENAMES)
+}
+
+// redirect sends a 301 if the request path is in the layout's redirects.
+// Returns false if it didn't.
+func redirect(res http.ResponseWriter, req *http.Request, l *layout.Layout) bool {
+	if l == nil {
+		return false
+	}
+	to, ok := l.Redirects.Resolve(req.URL.Path)
+	if !ok {
+		return false
+	}
+	if req.URL.RawQuery != "" && !strings.Contains(to, "?") {
+		to += "?" + req.URL.RawQuery
+	}
+	http.Redirect(res, req, to, http.StatusMovedPermanently)
+	return true
+}
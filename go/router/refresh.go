@@ -0,0 +1,173 @@
+package router
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"intermark/go/paths"
+	"intermark/go/system/tailwind"
+
+	"github.com/minio/sha256-simd"
+)
+
+// Edit mode refresh steps, each only reruns when its inputs changed since it last ran.
+const (
+	stepTemplates = "templates"
+	stepTailwind  = "tailwind"
+	stepLayout    = "layout"
+)
+
+var refreshSteps = []string{stepTemplates, stepTailwind, stepLayout}
+
+var metaDir = filepath.Join(paths.PUB_DIR, ".meta") // generated and config files, not content
+
+type refreshState struct {
+	mu     sync.Mutex
+	flight *refreshCall      // in-flight refresh, shared by concurrent callers
+	inputs map[string]string // step -> fingerprint of the inputs it last ran with
+	errs   map[string]error  // step -> error from that run
+}
+
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// refresh brings the templates, Tailwind output, and layout up to date with
+// the files they're built from. Steps whose inputs haven't changed are skipped
+// and return their last error. Concurrent calls share one run.
+func (r *Router) refresh() error {
+	rs := &r.refreshState
+	rs.mu.Lock()
+	if c := rs.flight; c != nil {
+		rs.mu.Unlock()
+		<-c.done
+		return c.err
+	}
+	c := &refreshCall{done: make(chan struct{})}
+	rs.flight = c
+	rs.mu.Unlock()
+
+	c.err = r.runRefresh()
+
+	rs.mu.Lock()
+	rs.flight = nil
+	rs.mu.Unlock()
+	close(c.done)
+	return c.err
+}
+
+// runRefresh runs the steps that need it, only called by one refresh at a time.
+func (r *Router) runRefresh() error {
+	rs := &r.refreshState
+	if rs.inputs == nil {
+		rs.inputs, rs.errs = map[string]string{}, map[string]error{}
+	}
+
+	tmpl, err := fingerprint(paths.TMPL_DIR, func(path string) bool { return filepath.Ext(path) == ".html" })
+	if err != nil {
+		return err
+	}
+	content, err := fingerprint(paths.PUB_DIR, nil)
+	if err != nil {
+		return err
+	}
+	appCSS, err := fingerprint(tailwind.INPUT_PATH, nil)
+	if err != nil {
+		return err
+	}
+	layoutJSON, err := fingerprint(paths.LAYOUT, nil)
+	if err != nil {
+		return err
+	}
+	redirects, err := fingerprint(paths.REDIRECTS, nil)
+	if err != nil {
+		return err
+	}
+	renames, err := fingerprint(paths.RENAMES, nil)
+	if err != nil {
+		return err
+	}
+	inputs := map[string]string{
+		stepTemplates: tmpl,
+		stepTailwind:  tmpl + content + appCSS, // classes come from templates and content
+		stepLayout:    content + layoutJSON + redirects + renames,
+	}
+
+	var todo []string
+	for _, step := range refreshSteps {
+		if inputs[step] != rs.inputs[step] {
+			todo = append(todo, step)
+		}
+	}
+	if len(todo) > 0 {
+		r.log.Debugf("Refreshing edit mode: %v\n", todo)
+		r.editMu.Lock()
+		for _, step := range todo {
+			switch step {
+			case stepTemplates:
+				rs.errs[step] = r.loadTemplates()
+			case stepTailwind:
+				rs.errs[step] = r.runTailwind(nil)
+			case stepLayout:
+				rs.errs[step] = r.layout.FromFile(r.ctx)
+				// FromFile rewrites layout.json, don't count that as a change
+				if layoutJSON, err := fingerprint(paths.LAYOUT, nil); err == nil {
+					inputs[step] = content + layoutJSON + redirects + renames
+				}
+			}
+			rs.inputs[step] = inputs[step]
+		}
+		r.editMu.Unlock()
+	}
+
+	for _, step := range refreshSteps {
+		if err := rs.errs[step]; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fingerprint hashes the paths, mod times, and sizes of the files under root
+// that match keep (all if nil). The .meta dir is skipped unless it's root.
+func fingerprint(root string, keep func(path string) bool) (string, error) {
+	var lines []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // missing inputs are a state too
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path == metaDir || d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if keep != nil && !keep(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		lines = append(lines, fmt.Sprintf("%s\x00%d\x00%d\n", path, info.ModTime().UnixNano(), info.Size()))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error fingerprinting %s: %w", root, err)
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
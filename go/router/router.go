@@ -15,6 +15,7 @@ import (
 	"intermark/go/env"
 	"intermark/go/files"
 	"intermark/go/layout"
+	"intermark/go/paths"
 	"intermark/go/system/tailwind"
 	"intermark/go/templates"
 
@@ -32,46 +33,49 @@ type Router struct {
 	ctx       context.Context
 	log       *logger.Logger
 	Router    *chi.Mux
-	templates *template.Template
-	layout    *layout.Layout
+	templates *template.Template // edit mode only, prod uses gen
+	layout    *layout.Layout     // edit mode only, prod uses gen
 	editMode  bool
 	debugMode bool
 
 	// prod stuff
+	gen           atomic.Pointer[generation] // live generation, nil until the first LoadAll finishes
+	distRoot      string                     // generation dirs are created in here
+	genSeq        int                        // last generation seq, only touched by LoadAll
 	pageCache     *files.LRU
 	assetCache    *files.LRU
-	searchHash    string            // perm cached lunrjs index hash
-	searchIdx     []byte            // perm cached lunrjs index
-	indexPage     []byte            // perm cached index page
-	assHashToPath map[string]string // "hash.ext" -> "/assets/example.ext"
-	assPathToHash map[string]string // "/assets/example.ext" -> "hash.ext"
 	updateFlag    atomic.Bool
+	updateLoop    atomic.Bool                   // RequestUpdate goroutine is running
+	updatePending atomic.Bool                   // RequestUpdate was called since the last run started
+	lastFailure   atomic.Pointer[UpdateFailure] // last update that was rolled back, if any
+	status        updateStatus
 
 	// edit stuff
-	editMu sync.RWMutex
+	editMu       sync.RWMutex
+	refreshState refreshState // what refresh last built from
+	live         liveReload   // pages to tell about source changes
 }
 
 func New(ctx context.Context, pageCacheBytes, assetCacheBytes int64, edit, debug bool) (*Router, error) {
 	r := &Router{
-		Router:        chi.NewRouter(),
-		templates:     nil,
-		layout:        &layout.Layout{},
-		pageCache:     files.NewLRU(true, pageCacheBytes),
-		assetCache:    files.NewLRU(true, assetCacheBytes),
-		assHashToPath: make(map[string]string),
-		assPathToHash: make(map[string]string),
-		editMode:      edit,
-		debugMode:     debug,
-		ctx:           ctx,
-		log:           logger.FromContext(ctx),
+		Router:     chi.NewRouter(),
+		distRoot:   paths.DIST_DIR,
+		templates:  nil,
+		layout:     &layout.Layout{},
+		pageCache:  files.NewLRU(true, pageCacheBytes),
+		assetCache: files.NewLRU(true, assetCacheBytes),
+		editMode:   edit,
+		debugMode:  debug,
+		ctx:        ctx,
+		log:        logger.FromContext(ctx),
 	}
 
 	if !r.editMode {
-		// update check middleware
+		// first load check middleware, later updates are swapped in without downtime
 		r.Router.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-				if r.IsUpdating() {
-					r.log.Debugf("Request while updating: %s\n", req.URL.Path)
+				if r.gen.Load() == nil {
+					r.log.Debugf("Request before first load: %s\n", req.URL.Path)
 					res.Header().Set("Content-Type", "text/html; charset=utf-8")
 					res.WriteHeader(http.StatusServiceUnavailable)
 					res.Write(updatingPage)
@@ -88,6 +92,17 @@ func New(ctx context.Context, pageCacheBytes, assetCacheBytes int64, edit, debug
 		if !r.editMode {
 			r.log.Warnf("serving static file without fingerprinting: %s\n", clean)
 		}
+		// missing files get the custom 404 page like unknown pages
+		if info, err := os.Stat(clean[1:]); err != nil || info.IsDir() {
+			if r.editMode {
+				r.editMu.RLock()
+				defer r.editMu.RUnlock()
+				r.editError(res, http.StatusNotFound, "404 page not found")
+			} else {
+				r.notFound(res, req)
+			}
+			return
+		}
 		res.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
 		http.ServeFile(res, req, clean[1:]) // remove leading "/"
 	})
@@ -95,6 +110,7 @@ func New(ctx context.Context, pageCacheBytes, assetCacheBytes int64, edit, debug
 	var err error = nil
 	if r.editMode {
 		r.setupEditRoutes()
+		err = r.startWatcher()
 	} else {
 		err = r.setupProdRoutes()
 	}
@@ -103,26 +119,27 @@ func New(ctx context.Context, pageCacheBytes, assetCacheBytes int64, edit, debug
 }
 
 func (r *Router) loadTemplates() error {
-	var err error
-	if r.templates, err = templates.LoadTemplates(r.ctx); err != nil {
+	tmpl, err := templates.LoadTemplates(r.ctx)
+	if err != nil {
 		return fmt.Errorf("error loading templates: %w", err)
 	}
+	r.templates = tmpl // keep the last good ones on error
 	return nil
 }
 
-func (r *Router) RunTailwind() error {
+// runTailwind builds out.css. If g is nil (edit mode) the output is left as is,
+// otherwise it's fingerprinted and copied into the generation's dist dir so
+// later runs can't change it underneath the live generation.
+func (r *Router) runTailwind(g *generation) error {
 	tCtx, tCancel := context.WithTimeout(r.ctx, getTimeout(env.IM_TAIL_M))
 	defer tCancel()
 
 	// run tailwind
-	var out string
-	var err error
-	if r.editMode {
-		_, err = tailwind.Run(tCtx, nil)
+	if g == nil {
+		_, err := tailwind.Run(tCtx, nil)
 		return err // no need to hash in edit mode
-	} else {
-		out, err = tailwind.Run(tCtx, r.assPathToHash)
 	}
+	out, err := tailwind.Run(tCtx, g.assPathToHash)
 	if err != nil {
 		r.log.Debugf("error tailwind output: \n\n%s\n\n", out)
 		return fmt.Errorf("error running tailwind: %w", err)
@@ -135,7 +152,12 @@ func (r *Router) RunTailwind() error {
 	sum := sha256.Sum256(data)
 	hash := hex.EncodeToString(sum[:])
 	aPath := hash + filepath.Ext(tailwind.OUTPUT_PATH)
-	r.assHashToPath[aPath] = tailwind.OUTPUT_PATH[1:] // remove leading "."
-	r.assPathToHash[tailwind.OUTPUT_PATH[1:]] = aPath
+	// copy into generation
+	genPath := filepath.Join(g.distDir, aPath)
+	if err := os.WriteFile(genPath, data, 0o644); err != nil {
+		return fmt.Errorf("error copying tailwind output to generation: %w", err)
+	}
+	g.assHashToPath[aPath] = "/" + filepath.ToSlash(genPath)
+	g.assPathToHash[tailwind.OUTPUT_PATH[1:]] = aPath // remove leading "."
 	return nil
 }
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"intermark/go/system/lunrjs"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// searchAPI handles GET /api/search?q=...&limit=...&section=...&tag=..., searching
+// the live generation's index server side so clients don't need /search.json.
+func (r *Router) searchAPI(res http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(res, "Missing q", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if s := req.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(res, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	filter := lunrjs.Filter{Section: req.URL.Query().Get("section"), Tags: req.URL.Query()["tag"]}
+
+	g := r.gen.Load()
+	results, total, facets := g.search.Search(q, limit, filter)
+	data, err := json.Marshal(map[string]any{
+		"query":   q,
+		"total":   total,
+		"results": results,
+		"facets":  facets,
+	})
+	if err != nil {
+		r.log.Errorf("error encoding search results: %v\n", err)
+		http.Error(res, "Error encoding results", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Write(data)
+}
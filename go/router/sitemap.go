@@ -0,0 +1,116 @@
+package router
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"intermark/go/env"
+	"intermark/go/files"
+	"intermark/go/layout"
+	"intermark/go/paths"
+	"intermark/go/system/git"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// lastModified returns the last commit time of each file in PUB_DIR, keyed by path
+// relative to it. Uncommitted files are missing. Errors are logged, not returned,
+// since dates are nice to have.
+func (r *Router) lastModified(cwd string) map[string]time.Time {
+	ctx, cancel := context.WithTimeout(r.ctx, getTimeout(env.IM_GIT_M))
+	defer cancel()
+	times, err := git.LastModified(ctx, cwd, paths.PUB_DIR)
+	if err != nil {
+		r.log.Warnf("Error getting last modified times from git: %v\n", err)
+	}
+	out := make(map[string]time.Time, len(times))
+	for path, t := range times {
+		out[strings.TrimPrefix(path, paths.PUB_DIR+"/")] = t
+	}
+	return out
+}
+
+// genSitemap sets g.sitemap to a gzipped sitemap of the index and every built page,
+// with lastmod from modTimes. Sitemaps need absolute urls, so it's left nil if
+// IM_BASE_URL is not set.
+func (r *Router) genSitemap(g *generation, modTimes map[string]time.Time) error {
+	base := strings.TrimSuffix(env.Get(env.IM_BASE_URL), "/")
+	if base == "" {
+		r.log.Warnf("IM_BASE_URL is not set, skipping sitemap.xml\n")
+		return nil
+	}
+	lastMod := func(path string) string {
+		if t, ok := modTimes[filepath.ToSlash(path)]; ok {
+			return t.UTC().Format(time.RFC3339)
+		}
+		return ""
+	}
+
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	set.URLs = append(set.URLs, sitemapURL{Loc: base + "/", LastMod: lastMod(".index.md")})
+	g.layout.Walk(func(si *layout.SidebarItem) (bool, error) {
+		if si.Type == "file" && !si.Draft {
+			set.URLs = append(set.URLs, sitemapURL{Loc: base + si.Link, LastMod: lastMod(si.Path)})
+		}
+		return false, nil
+	})
+
+	data, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sitemap: %w", err)
+	}
+	if g.sitemap, err = gzipBytes(append([]byte(xml.Header), data...)); err != nil {
+		return fmt.Errorf("error compressing sitemap: %w", err)
+	}
+	r.log.Debugf("Generated sitemap.xml with %d urls\n", len(set.URLs))
+	return nil
+}
+
+// genRobots sets g.robots to a gzipped robots.txt. Uses public/.robots.txt as is if
+// present, otherwise allows or disallows everything depending on IM_ROBOTS.
+func (r *Router) genRobots(g *generation) error {
+	custom := filepath.Join(paths.PUB_DIR, ".robots.txt")
+	var data []byte
+	if exists, err := files.Exists(custom); err != nil {
+		return err
+	} else if exists {
+		if data, err = os.ReadFile(custom); err != nil {
+			return fmt.Errorf("error reading %s: %w", custom, err)
+		}
+	} else {
+		var b strings.Builder
+		b.WriteString("User-agent: *\n")
+		switch mode := env.Get(env.IM_ROBOTS); mode {
+		case "disallow":
+			b.WriteString("Disallow: /\n")
+		default:
+			if mode != "allow" {
+				r.log.Warnf("Invalid IM_ROBOTS %q, using allow\n", mode)
+			}
+			b.WriteString("Allow: /\nDisallow: /update\n")
+			if g.sitemap != nil {
+				b.WriteString("\nSitemap: " + strings.TrimSuffix(env.Get(env.IM_BASE_URL), "/") + "/sitemap.xml\n")
+			}
+		}
+		data = []byte(b.String())
+	}
+	var err error
+	if g.robots, err = gzipBytes(data); err != nil {
+		return fmt.Errorf("error compressing robots.txt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"intermark/go/env"
+	"intermark/go/files"
+	"intermark/go/paths"
+)
+
+// Update phases, in the order they normally run.
+const (
+	PhaseIdle     = "idle"
+	PhaseFetch    = "fetch"
+	PhaseReset    = "reset"
+	PhaseLFS      = "lfs"
+	PhaseAssets   = "assets"
+	PhaseTailwind = "tailwind"
+	PhaseDist     = "dist"
+	PhaseSearch   = "search"
+	PhaseRollback = "rollback"
+)
+
+const maxHistory = 20 // number of updates kept in history
+
+// PhaseTime is how long a single update phase took.
+type PhaseTime struct {
+	Name string `json:"name"`
+	MS   int64  `json:"ms"`
+}
+
+// UpdateRecord is a single update in the history.
+type UpdateRecord struct {
+	Commit string      `json:"commit"` // commit updated to, or attempted
+	Start  time.Time   `json:"start"`
+	End    time.Time   `json:"end"`
+	Phases []PhaseTime `json:"phases"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// updateStatus tracks the current update phase and the update history.
+type updateStatus struct {
+	mu         sync.Mutex
+	phase      string
+	phaseStart time.Time
+	current    *UpdateRecord   // nil when not updating
+	history    []*UpdateRecord // newest first
+}
+
+// load reads the persisted history, missing is fine.
+func (s *updateStatus) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = PhaseIdle
+	if err := files.LoadJSON(paths.UPDATE_HISTORY, &s.history); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// begin starts a new update record.
+func (s *updateStatus) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.current = &UpdateRecord{Start: now, Phases: []PhaseTime{}}
+	s.phase = PhaseIdle
+	s.phaseStart = now
+}
+
+// setPhase ends the running phase and starts the given one.
+// Outside of an update (e.g. the first load) only the phase is tracked.
+func (s *updateStatus) setPhase(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endPhase()
+	s.phase = phase
+	s.phaseStart = time.Now()
+}
+
+// endPhase records the running phase's duration, lock must be held.
+func (s *updateStatus) endPhase() {
+	if s.current != nil && s.phase != PhaseIdle {
+		s.current.Phases = append(s.current.Phases, PhaseTime{Name: s.phase, MS: time.Since(s.phaseStart).Milliseconds()})
+	}
+}
+
+// end finishes the current update record, adds it to the history, and saves the history.
+func (s *updateStatus) end(commit string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		s.phase = PhaseIdle
+		return nil
+	}
+	s.endPhase()
+	s.phase = PhaseIdle
+	s.current.Commit = commit
+	s.current.End = time.Now()
+	if err != nil {
+		s.current.Error = err.Error()
+	}
+	s.history = append([]*UpdateRecord{s.current}, s.history...)
+	if len(s.history) > maxHistory {
+		s.history = s.history[:maxHistory]
+	}
+	s.current = nil
+	return files.SaveJSON(paths.UPDATE_HISTORY, s.history, 0o644)
+}
+
+// MarshalJSON returns the status as served by /update/status.
+func (s *updateStatus) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(map[string]any{
+		"phase":   s.phase,
+		"current": s.current,
+		"history": s.history,
+	})
+}
+
+// setupStatusRoute adds GET /update/status, authed with `Authorization: Bearer <IM_UPDATE_SECRET>`.
+func (r *Router) setupStatusRoute() {
+	r.Router.Get("/update/status", func(res http.ResponseWriter, req *http.Request) {
+		token := env.Get(env.IM_UPDATE_SECRET)
+		if token == "" {
+			http.Error(res, "Update token not set", http.StatusInternalServerError)
+			return
+		}
+		bearer, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		data, err := json.Marshal(map[string]any{
+			"updating":    r.IsUpdating(),
+			"liveCommit":  os.Getenv(DIST_CM_KEY),
+			"lastFailure": r.LastFailure(),
+			"status":      &r.status,
+		})
+		if err != nil {
+			r.log.Errorf("error encoding update status: %v\n", err)
+			http.Error(res, "Error encoding status", http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Cache-Control", "no-store")
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(data)
+	})
+}
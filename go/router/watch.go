@@ -0,0 +1,223 @@
+package router
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"intermark/go/paths"
+	"intermark/go/system/tailwind"
+)
+
+// Edit mode live reload. Sources are polled rather than watched with OS
+// notifications so it works the same everywhere without cgo or extra deps.
+
+const (
+	watchInterval = 500 * time.Millisecond
+	sseKeepAlive  = 30 * time.Second
+)
+
+// live reload event names, sent to the page as SSE event types
+const (
+	eventReload = "reload" // reload the page
+	eventCSS    = "css"    // only stylesheets changed, swap them in place
+)
+
+var watchedDirs = []string{paths.PUB_DIR, paths.ASS_DIR, paths.TMPL_DIR}
+
+// skipped dirs, generated or not content
+var watchSkipDirs = map[string]bool{
+	filepath.Clean(paths.DIST_DIR):        true,
+	filepath.Clean(paths.EXPORT_DIST_DIR): true,
+	".git":                                true,
+	"node_modules":                        true,
+}
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// liveReload fans events out to the open pages' SSE connections.
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan string]struct{}
+}
+
+func (lr *liveReload) subscribe() chan string {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.clients == nil {
+		lr.clients = map[chan string]struct{}{}
+	}
+	ch := make(chan string, 1)
+	lr.clients[ch] = struct{}{}
+	return ch
+}
+
+func (lr *liveReload) unsubscribe(ch chan string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	delete(lr.clients, ch)
+}
+
+// broadcast sends event to every client, skipping ones that haven't read the last one yet.
+func (lr *liveReload) broadcast(event string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for ch := range lr.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// startWatcher does the first refresh, then refreshes once per batch of
+// changes to the sources and tells open pages to reload. Refresh errors are
+// logged here and shown by the page handlers until the sources are fixed.
+func (r *Router) startWatcher() error {
+	if err := r.refresh(); err != nil {
+		r.log.Errorf("error refreshing edit mode: %v\n", err)
+	}
+	prev, err := scanSources()
+	if err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		pending := ""
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur, err := scanSources()
+			if err != nil {
+				r.log.Warnf("error scanning for changes: %v\n", err)
+				continue
+			}
+			// wait for a quiet tick so editors saving several files cause one refresh
+			if event := changeEvent(prev, cur); event != "" {
+				prev = cur
+				if pending != eventReload {
+					pending = event
+				}
+				continue
+			}
+			if pending == "" {
+				continue
+			}
+			r.log.Debugf("Sources changed, refreshing\n")
+			if err := r.refresh(); err != nil {
+				r.log.Errorf("error refreshing edit mode: %v\n", err)
+				pending = eventReload // show the error page
+			}
+			// rescan so the refresh's own writes, e.g. layout.json, aren't seen as changes
+			if cur, err := scanSources(); err == nil {
+				prev = cur
+			}
+			r.live.broadcast(pending)
+			pending = ""
+		}
+	}()
+	return nil
+}
+
+// scanSources stats every file in watchedDirs.
+func scanSources() (map[string]fileStamp, error) {
+	snap := map[string]fileStamp{}
+	outCSS := filepath.Clean(tailwind.OUTPUT_PATH)
+	for _, dir := range watchedDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil // removed mid walk
+				}
+				return err
+			}
+			if d.IsDir() {
+				if watchSkipDirs[path] || watchSkipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path == outCSS {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			snap[path] = fileStamp{info.ModTime(), info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning %s: %w", dir, err)
+		}
+	}
+	return snap, nil
+}
+
+// changeEvent returns the event for the changes between two scans, "" if none.
+// Edited stylesheets can be swapped in place, anything else needs a reload.
+func changeEvent(prev, cur map[string]fileStamp) string {
+	event := ""
+	for path, st := range cur {
+		old, ok := prev[path]
+		if ok && old.size == st.size && old.mod.Equal(st.mod) {
+			continue
+		}
+		if !ok || filepath.Ext(path) != ".css" {
+			return eventReload
+		}
+		event = eventCSS
+	}
+	for path := range prev {
+		if _, ok := cur[path]; !ok {
+			return eventReload
+		}
+	}
+	return event
+}
+
+// liveEvents handles GET /edit/events, an SSE stream of live reload events.
+func (r *Router) liveEvents(res http.ResponseWriter, req *http.Request) {
+	rc := http.NewResponseController(res)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil { // outlive the server's write timeout
+		r.log.Errorf("error clearing write deadline for live reload: %v\n", err)
+		http.Error(res, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := r.live.subscribe()
+	defer r.live.unsubscribe(ch)
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(res, "retry: 1000\n\n")
+	rc.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-r.ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(res, ": ping\n\n")
+		case event := <-ch:
+			fmt.Fprintf(res, "event: %s\ndata: {}\n\n", event)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/minio/sha256-simd"
+)
+
+const maxUpdateBody = 25 << 20 // 25MB, github's max webhook payload size
+
+var errUnauthorized = errors.New("unauthorized")
+
+// pushPayload is the subset of push webhook payloads needed to find the pushed branch.
+type pushPayload struct {
+	// GitHub, Gitea, Forgejo, and GitLab, e.g. "refs/heads/main"
+	Ref string `json:"ref"`
+	// Bitbucket
+	Push struct {
+		Changes []struct {
+			New *struct {
+				Type string `json:"type"` // "branch" or "tag"
+				Name string `json:"name"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+}
+
+// checkUpdateRequest authenticates an /update request and returns whether it
+// should trigger an update. Returns errUnauthorized if verification fails.
+//
+// Supported:
+//   - Plain: body is the secret, as sent by the bundled CI workflows.
+//   - GitHub, Gitea, Forgejo: HMAC-SHA256 of the body in X-Hub-Signature-256 / X-Gitea-Signature / X-Forgejo-Signature.
+//   - Bitbucket: HMAC-SHA256 of the body in X-Hub-Signature.
+//   - GitLab: secret in X-Gitlab-Token.
+//
+// Webhooks only trigger an update when they're a push to branch, so pings,
+// tag pushes, and pushes to other branches are accepted but ignored.
+func checkUpdateRequest(req *http.Request, body []byte, secret, branch string) (bool, error) {
+	h := req.Header
+	var ok bool
+	switch {
+	case h.Get("X-Hub-Signature-256") != "":
+		ok = validHMAC(body, secret, strings.TrimPrefix(h.Get("X-Hub-Signature-256"), "sha256="))
+	case h.Get("X-Gitea-Signature") != "":
+		ok = validHMAC(body, secret, h.Get("X-Gitea-Signature"))
+	case h.Get("X-Forgejo-Signature") != "":
+		ok = validHMAC(body, secret, h.Get("X-Forgejo-Signature"))
+	case h.Get("X-Hub-Signature") != "":
+		sig, found := strings.CutPrefix(h.Get("X-Hub-Signature"), "sha256=")
+		ok = found && validHMAC(body, secret, sig)
+	case h.Get("X-Gitlab-Token") != "":
+		ok = subtle.ConstantTimeCompare([]byte(h.Get("X-Gitlab-Token")), []byte(secret)) == 1
+	default:
+		// plain secret, always triggers an update
+		if subtle.ConstantTimeCompare(body, []byte(secret)) != 1 {
+			return false, errUnauthorized
+		}
+		return true, nil
+	}
+	if !ok {
+		return false, errUnauthorized
+	}
+	return isPushTo(req, body, branch)
+}
+
+// validHMAC reports whether sigHex is the hex HMAC-SHA256 of body with secret.
+func validHMAC(body []byte, secret, sigHex string) bool {
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// isPushTo reports whether the webhook payload is a push to branch.
+func isPushTo(req *http.Request, body []byte, branch string) (bool, error) {
+	// github can send form encoded payloads
+	if ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); ct == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return false, fmt.Errorf("error parsing form payload: %w", err)
+		}
+		body = []byte(form.Get("payload"))
+	}
+	var p pushPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return false, fmt.Errorf("error parsing payload: %w", err)
+	}
+	if p.Ref != "" {
+		return p.Ref == "refs/heads/"+branch, nil
+	}
+	for _, c := range p.Push.Changes {
+		if c.New != nil && c.New.Type == "branch" && c.New.Name == branch {
+			return true, nil
+		}
+	}
+	return false, nil
+}
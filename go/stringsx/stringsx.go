@@ -4,40 +4,70 @@ import "strings"
 
 const delimiters = " \t\n\"'()<>[]{}"
 
-// FastLinkReplace replaces /assets/ links with /a/hash links.
-// It skips escaped ones with extra slashes, removing one in the process.
-func FastLinkReplace(input string, pathToHash map[string]string) string {
-	var b strings.Builder
-	b.Grow(len(input))
-	const token = "/assets/"
-	const tokenLen = len(token)
+const assetToken = "/assets/"
+
+// eachAssetLink calls fn with the bounds of every /assets/ link in input. A
+// link runs to the next delimiter. Escaped ones have extra leading slashes.
+func eachAssetLink(input string, fn func(start, end int, escaped bool)) {
 	for i := 0; i < len(input); {
 		// find next asset
-		off := strings.Index(input[i:], token)
+		off := strings.Index(input[i:], assetToken)
 		if off < 0 {
-			b.WriteString(input[i:])
-			break
+			return
 		}
 		start := i + off
-		// write everything up to the asset
-		b.WriteString(input[i:start])
 		// locate end of the asset path
-		j := start + tokenLen
+		j := start + len(assetToken)
 		if pos := strings.IndexAny(input[j:], delimiters); pos >= 0 {
 			j += pos
 		} else {
 			j = len(input)
 		}
-		asset := input[start:j]
-		if start >= 1 && input[start-1] == '/' { // if 2+ leading '/', drop one e.g. "///assets/foo.png" -> "//assets/foo.png"
-			b.WriteString(asset[1:])
-		} else if hash, ok := pathToHash[asset]; ok {
+		fn(start, j, start >= 1 && input[start-1] == '/')
+		// advance past consumed asset
+		i = j
+	}
+}
+
+// FastLinkReplace replaces /assets/ links with /a/hash links.
+// It skips escaped ones with extra slashes, removing one in the process.
+func FastLinkReplace(input string, pathToHash map[string]string) string {
+	var b strings.Builder
+	b.Grow(len(input))
+	i := 0
+	eachAssetLink(input, func(start, end int, escaped bool) {
+		if escaped { // if 2+ leading '/', drop one e.g. "///assets/foo.png" -> "//assets/foo.png"
+			b.WriteString(input[i:start])
+			i = start + 1
+			return
+		}
+		// write everything up to the asset
+		b.WriteString(input[i:start])
+		asset := input[start:end]
+		if hash, ok := pathToHash[asset]; ok {
 			b.WriteString("/a/" + hash)
 		} else { // fallback
 			b.WriteString(asset)
 		}
-		// advance past consumed asset
-		i = j
-	}
+		i = end
+	})
+	b.WriteString(input[i:])
 	return b.String()
 }
+
+// AssetLinks returns the /assets/ links FastLinkReplace would look up in
+// input, in order, with duplicates.
+func AssetLinks(input string) []string {
+	var links []string
+	eachAssetLink(input, func(start, end int, escaped bool) {
+		if !escaped {
+			links = append(links, input[start:end])
+		}
+	})
+	return links
+}
+
+// LinkSafe reports whether name can be part of an /assets/ link without ending it early.
+func LinkSafe(name string) bool {
+	return !strings.ContainsAny(name, delimiters)
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"intermark/go/system"
 
@@ -138,6 +139,60 @@ func GetUpstreamCommitHash(ctx context.Context, repoDirPath string) (string, err
 	return system.RunCommand(ctx, cmd)
 }
 
+// GetRemoteCommitHash returns the hash of the local remote-tracking ref for the given branch, e.g. origin/main.
+func GetRemoteCommitHash(ctx context.Context, repoDirPath, remote, branch string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", remote+"/"+branch)
+	cmd.Dir = repoDirPath
+	return system.RunCommand(ctx, cmd)
+}
+
+// LastModified returns the commit time of the last commit touching each file under dir,
+// keyed by path relative to the repo root, e.g. "public/usage/deployment.md".
+// Uses a single pass over the log instead of one command per file.
+func LastModified(ctx context.Context, repoDirPath, dir string) (map[string]time.Time, error) {
+	cmd := exec.CommandContext(ctx, "git", "-c", "core.quotePath=false", "log", "--name-only", "--format=format:%x00%cI", "--", dir)
+	cmd.Dir = repoDirPath
+	out, err := system.RunCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running git log: %w", err)
+	}
+	// newest first, so the first time a file shows up is its last change
+	times := map[string]time.Time{}
+	var cur time.Time
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "\x00") {
+			if cur, err = time.Parse(time.RFC3339, line[1:]); err != nil {
+				return nil, fmt.Errorf("error parsing commit time %q: %w", line[1:], err)
+			}
+			continue
+		}
+		if _, ok := times[line]; !ok && line != "" {
+			times[line] = cur
+		}
+	}
+	return times, nil
+}
+
+// Renames returns files under dir renamed between the given commits, old path -> new path,
+// both relative to the repo root.
+func Renames(ctx context.Context, repoDirPath, from, to, dir string) (map[string]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-c", "core.quotePath=false", "diff", "--name-status", "--find-renames", from, to, "--", dir)
+	cmd.Dir = repoDirPath
+	out, err := system.RunCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running git diff: %w", err)
+	}
+	// lines look like "R097\told/path\tnew/path"
+	renames := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 3 && strings.HasPrefix(fields[0], "R") {
+			renames[fields[1]] = fields[2]
+		}
+	}
+	return renames, nil
+}
+
 // Clone clones the given repository into the given directory.
 // If the directory already exists, it will be removed first.
 func Clone(ctx context.Context, repoURL, repoDirPath string) error {
@@ -169,37 +224,42 @@ func Clone(ctx context.Context, repoURL, repoDirPath string) error {
 	return nil
 }
 
-// Fetch fetches the latest changes from the given branch for the given repository.
-func Fetch(ctx context.Context, repoDirPath, branch string) error {
+// Fetch fetches the latest changes from the given remote branch for the given repository.
+func Fetch(ctx context.Context, repoDirPath, remote, branch string) error {
 	if err := ensureGitDir(repoDirPath); err != nil {
 		return err
 	}
 
 	// fetch latest changes
-	cmd := exec.CommandContext(ctx, "git", "fetch", "origin", branch)
+	cmd := exec.CommandContext(ctx, "git", "fetch", remote, branch)
 	cmd.Env = getENV(ctx)
 	cmd.Dir = repoDirPath
 	_, err := system.RunCommand(ctx, cmd)
 	return err
 }
 
-// Reset resets the given repository to the latest local commit on the given branch.
+// Reset resets the given repository to the latest fetched commit on the given remote branch.
 //
 // Example usage:
 //
 //	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 //	defer cancel()
-//	err := git.Reset(ctx, "/path/to/repo", "main", true)
+//	err := git.Reset(ctx, "/path/to/repo", "origin", "main", true)
 //
 //	if err != nil {
 //		log.Fatalf("Failed to reset repository: %v", err)
 //	}
-func Reset(ctx context.Context, repoDirPath, branch string, hard bool) error {
+func Reset(ctx context.Context, repoDirPath, remote, branch string, hard bool) error {
+	return ResetTo(ctx, repoDirPath, remote+"/"+branch, hard)
+}
+
+// ResetTo resets the given repository to the given ref, e.g. a commit hash.
+func ResetTo(ctx context.Context, repoDirPath, ref string, hard bool) error {
 	if err := ensureGitDir(repoDirPath); err != nil {
 		return err
 	}
 
-	args := []string{"reset", "origin/" + branch}
+	args := []string{"reset", ref}
 	if hard {
 		args = append(args, "--hard")
 	}
@@ -19,6 +19,8 @@ const docs = JSON.parse(fs.readFileSync(docsPath, 'utf8'))
 const idx = lunr(function () {
   this.ref('id')
   this.field('title', { boost: 10 })
+  // the headings above this one, starting with the page title
+  this.field('breadcrumb', { boost: 5, extractor: d => (d.breadcrumb || []).slice(0, -1).join(' ') })
   this.field('body')
   docs.forEach(d => this.add(d))
 })
@@ -0,0 +1,221 @@
+package lunrjs
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"intermark/go/html"
+)
+
+// Port of lunr.Builder with gen_index.js's config, ref "id", fields "title"
+// (boost 10), "breadcrumb" (boost 5, the headings above), and "body". Index.JSON's output is byte for byte what gen_index.js
+// writes, so the client can't tell which one built it.
+
+const VERSION = "2.3.9" // lunr.version of assets/js/lunr.js
+
+var (
+	fieldNames  = []string{"title", "breadcrumb", "body"}
+	fieldBoosts = map[string]float64{"title": 10, "breadcrumb": 5, "body": 1}
+
+	// BM25 params, vars so the math isn't done at constant precision
+	bm25K1 float64 = 1.2
+	bm25B  float64 = 0.75
+)
+
+type posting struct {
+	index int
+	refs  map[string][]string // field -> doc refs, in insertion order
+	seen  map[string]bool     // field + "/" + ref
+}
+
+type builder struct {
+	docCount     int
+	termIndex    int
+	inverted     map[string]*posting
+	fieldRefs    []string                  // "field/ref", insertion order
+	termFreqs    map[string]map[string]int // "field/ref" -> term -> count
+	fieldLengths map[string]int            // "field/ref" -> token count
+}
+
+// newBuilder indexes docs like lunr.js.
+func newBuilder(docs []html.Doc) *builder {
+	bd := &builder{
+		inverted:     map[string]*posting{},
+		termFreqs:    map[string]map[string]int{},
+		fieldLengths: map[string]int{},
+	}
+	for _, d := range docs {
+		bd.add(d)
+	}
+	return bd
+}
+
+// add is lunr.Builder.prototype.add.
+func (bd *builder) add(d html.Doc) {
+	bd.docCount++
+	for _, field := range fieldNames {
+		terms := runPipeline(tokenize(fieldText(d, field)))
+		fieldRef := field + "/" + d.ID
+		if _, ok := bd.termFreqs[fieldRef]; !ok {
+			bd.fieldRefs = append(bd.fieldRefs, fieldRef)
+		}
+		freqs := map[string]int{} // a repeated ref replaces the earlier one, like JS
+		bd.termFreqs[fieldRef] = freqs
+		bd.fieldLengths[fieldRef] = len(terms)
+		for _, term := range terms {
+			freqs[term]++
+			p, ok := bd.inverted[term]
+			if !ok {
+				p = &posting{index: bd.termIndex, refs: map[string][]string{}, seen: map[string]bool{}}
+				bd.termIndex++
+				bd.inverted[term] = p
+			}
+			if !p.seen[fieldRef] {
+				p.seen[fieldRef] = true
+				p.refs[field] = append(p.refs[field], d.ID)
+			}
+		}
+	}
+}
+
+// fieldText is what gen_index.js indexes for field.
+func fieldText(d html.Doc, field string) string {
+	switch field {
+	case "title":
+		return d.Title
+	case "breadcrumb":
+		if len(d.Breadcrumb) < 2 {
+			return ""
+		}
+		return strings.Join(d.Breadcrumb[:len(d.Breadcrumb)-1], " ")
+	}
+	return d.Body
+}
+
+// idf is lunr.idf.
+func (p *posting) idf(docCount int) float64 {
+	withTerm := 0
+	for _, refs := range p.refs {
+		withTerm += len(refs)
+	}
+	x := (float64(docCount-withTerm) + 0.5) / (float64(withTerm) + 0.5)
+	return math.Log(1 + math.Abs(x))
+}
+
+// fieldVectors is calculateAverageFieldLengths and createFieldVectors. Each
+// vector is flattened [termIndex, score, ...] sorted by termIndex.
+func (bd *builder) fieldVectors() [][]float64 {
+	// average field lengths
+	sums, counts := map[string]float64{}, map[string]float64{}
+	for _, fieldRef := range bd.fieldRefs {
+		field := fieldOf(fieldRef)
+		sums[field] += float64(bd.fieldLengths[fieldRef])
+		counts[field]++
+	}
+
+	idfs := map[string]float64{}
+	vectors := make([][]float64, 0, len(bd.fieldRefs))
+	for _, fieldRef := range bd.fieldRefs {
+		field := fieldOf(fieldRef)
+		avg := sums[field] / counts[field]
+		fieldLength := float64(bd.fieldLengths[fieldRef])
+		type elem struct {
+			index int
+			score float64
+		}
+		elems := make([]elem, 0, len(bd.termFreqs[fieldRef]))
+		for term, tf := range bd.termFreqs[fieldRef] {
+			p := bd.inverted[term]
+			idf, ok := idfs[term]
+			if !ok {
+				idf = p.idf(bd.docCount)
+				idfs[term] = idf
+			}
+			// same operation order as JS, conversions stop the compiler fusing
+			ftf := float64(tf)
+			num := float64(idf * float64((bm25K1+1)*ftf))
+			den := float64(bm25K1*(1-bm25B+float64(bm25B*(fieldLength/avg)))) + ftf
+			score := float64(float64(num/den) * fieldBoosts[field])
+			elems = append(elems, elem{p.index, jsRound(float64(score*1000)) / 1000})
+		}
+		sort.Slice(elems, func(i, j int) bool { return elems[i].index < elems[j].index })
+		vec := make([]float64, 0, len(elems)*2)
+		for _, e := range elems {
+			vec = append(vec, float64(e.index), e.score)
+		}
+		vectors = append(vectors, vec)
+	}
+	return vectors
+}
+
+// serialize is lunr.Index.prototype.toJSON wrapped in { index }, pretty printed.
+func (bd *builder) serialize() []byte {
+	vectors := bd.fieldVectors()
+	fieldVectors := make([]any, len(bd.fieldRefs))
+	for i, fieldRef := range bd.fieldRefs {
+		fieldVectors[i] = []any{fieldRef, vectors[i]}
+	}
+
+	terms := make([]string, 0, len(bd.inverted))
+	for term := range bd.inverted {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool { return lessUTF16(terms[i], terms[j]) })
+	inverted := make([]any, len(terms))
+	for i, term := range terms {
+		p := bd.inverted[term]
+		entry := jsonObject{{"_index", p.index}}
+		for _, field := range fieldNames {
+			refs := jsonObject{}
+			for _, ref := range p.refs[field] {
+				refs = append(refs, jsonField{ref, jsonObject{}})
+			}
+			entry = append(entry, jsonField{field, refs})
+		}
+		inverted[i] = []any{term, entry}
+	}
+
+	fields := make([]any, len(fieldNames))
+	for i, f := range fieldNames {
+		fields[i] = f
+	}
+	return marshalIndent(jsonObject{{"index", jsonObject{
+		{"version", VERSION},
+		{"fields", fields},
+		{"fieldVectors", fieldVectors},
+		{"invertedIndex", inverted},
+		{"pipeline", []any{"stemmer"}},
+	}}})
+}
+
+// fieldOf is lunr.FieldRef.fromString(s).fieldName.
+func fieldOf(fieldRef string) string {
+	for i := 0; i < len(fieldRef); i++ {
+		if fieldRef[i] == '/' {
+			return fieldRef[:i]
+		}
+	}
+	return fieldRef
+}
+
+// jsRound is Math.round, halves round towards +Infinity.
+func jsRound(x float64) float64 {
+	r := math.Floor(x)
+	if x-r >= 0.5 {
+		r++
+	}
+	return r
+}
+
+// lessUTF16 compares like JS's default sort, by UTF-16 code units.
+func lessUTF16(x, y string) bool {
+	ua, ub := utf16.Encode([]rune(x)), utf16.Encode([]rune(y))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
@@ -0,0 +1,52 @@
+package lunrjs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"intermark/go/html"
+)
+
+// testdata/index.json is built from testdata/docs.json by lunr.js 2.3.9 with
+// the same setup as gen_index.js. Regenerate it with lunr.js if the two change.
+func TestIndexMatchesLunr(t *testing.T) {
+	data, err := os.ReadFile("testdata/docs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []html.Doc
+	if err := json.Unmarshal(data, &docs); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := NewIndex(docs).JSON()
+	if !bytes.Equal(got, want) {
+		gotLines, wantLines := bytes.Split(got, []byte("\n")), bytes.Split(want, []byte("\n"))
+		for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+			if !bytes.Equal(gotLines[i], wantLines[i]) {
+				t.Fatalf("index differs from lunr.js at line %d:\ngot:  %s\nwant: %s", i+1, gotLines[i], wantLines[i])
+			}
+		}
+		t.Fatalf("index differs from lunr.js in length: got %d lines, want %d", len(gotLines), len(wantLines))
+	}
+}
+
+func TestStem(t *testing.T) {
+	for in, want := range map[string]string{
+		"hopping":    "hop",
+		"falling":    "fall",
+		"caresses":   "caress",
+		"ponies":     "poni",
+		"relational": "relat",
+		"soññing":    "soñ", // doubled non-ASCII letter, dropped as a whole rune
+	} {
+		if got := stem(in); got != want {
+			t.Errorf("stem(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package lunrjs
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A minimal JSON.stringify(v, null, 2). encoding/json differs in key order,
+// HTML escaping, and number formatting, any of which would change the hash.
+
+type jsonField struct {
+	key string
+	val any
+}
+
+// jsonObject keeps keys in insertion order, like a JS object with string keys.
+type jsonObject []jsonField
+
+// marshalIndent supports jsonObject, []any, []float64, string, int, and float64.
+func marshalIndent(v any) []byte {
+	var buf bytes.Buffer
+	writeJSON(&buf, v, "")
+	return buf.Bytes()
+}
+
+func writeJSON(buf *bytes.Buffer, v any, indent string) {
+	inner := indent + "  "
+	switch v := v.(type) {
+	case jsonObject:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i, f := range v {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(inner)
+			writeJSONString(buf, f.key)
+			buf.WriteString(": ")
+			writeJSON(buf, f.val, inner)
+		}
+		buf.WriteString("\n" + indent + "}")
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(inner)
+			writeJSON(buf, e, inner)
+		}
+		buf.WriteString("\n" + indent + "]")
+	case []float64:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for i, n := range v {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(inner + jsNumber(n))
+		}
+		buf.WriteString("\n" + indent + "]")
+	case string:
+		writeJSONString(buf, v)
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case float64:
+		buf.WriteString(jsNumber(v))
+	}
+}
+
+// writeJSONString quotes s like JSON.stringify. Invalid UTF-8 was already
+// U+FFFD by the time node saw it, so it's written as that.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+			} else {
+				buf.WriteRune(r) // bad bytes come out of range as RuneError
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// jsNumber formats n like Number.prototype.toString.
+func jsNumber(n float64) string {
+	switch {
+	case math.IsNaN(n), math.IsInf(n, 0):
+		return "null" // what JSON.stringify writes
+	case n == 0:
+		return "0"
+	}
+	if abs := math.Abs(n); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	// e.g. 1e+21 and 1.5e-7
+	s := strconv.FormatFloat(n, 'e', -1, 64)
+	mant, exp, _ := strings.Cut(s, "e")
+	sign := exp[0]
+	exp = strings.TrimLeft(exp[1:], "0")
+	return mant + "e" + string(sign) + exp
+}
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"intermark/go/env"
 	"intermark/go/files"
 	"intermark/go/html"
 	"intermark/go/system"
@@ -23,41 +24,59 @@ const (
 	INDEX_PATH  = "./public/.meta/search-index.json"
 )
 
-// Run returns:
-//   - JSON.stringify({ index: JSON.stringify(idx), hash }) as a gzipped byte array.
+// Run builds the search index in process, or with gen_index.js and node if
+// IM_LUNR_NODE is "true". Returns:
+//   - the index, for searching server side.
+//   - JSON.stringify({ index: idx }, null, 2) as a gzipped byte array.
 //   - the hash of the index as a string.
 //   - an error if any.
-func Run(ctx context.Context, docs *[]html.Doc) ([]byte, string, error) {
-	// write the search docs file
-	if err := os.MkdirAll(filepath.Dir(DOCS_PATH), 0o755); err != nil {
-		return nil, "", fmt.Errorf("error creating search docs directory %s: %w", DOCS_PATH, err)
-	}
-	if err := files.SaveJSON(DOCS_PATH, &docs, 0o644); err != nil {
-		return nil, "", fmt.Errorf("error writing search docs file %s: %w", DOCS_PATH, err)
-	}
-
-	// run the tailwindcss command
-	cmd := exec.CommandContext(ctx, "node", SCRIPT_PATH, "-q")
-	cout, err := system.RunCommand(ctx, cmd)
-	if err != nil {
-		return nil, "", fmt.Errorf("error running lunrjs script %s: %w\n%s", SCRIPT_PATH, err, cout)
+func Run(ctx context.Context, docs *[]html.Doc) (*Index, []byte, string, error) {
+	idx := NewIndex(*docs)
+	var out []byte
+	if env.Get(env.IM_LUNR_NODE) == "true" {
+		var err error
+		if out, err = runNode(ctx, docs); err != nil {
+			return nil, nil, "", err
+		}
+	} else {
+		out = idx.JSON()
 	}
-	// read and gzip the output
-	out, err := os.ReadFile(INDEX_PATH)
+	gz, hash, err := pack(out)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, "", err
 	}
+	return idx, gz, hash, nil
+}
+
+// pack returns data gzipped and its hash.
+func pack(data []byte) ([]byte, string, error) {
 	// calculate the hash of the output
-	sum := sha256.Sum256(out)
+	sum := sha256.Sum256(data)
 	hash := hex.EncodeToString(sum[:])
 	// gzip the output
 	var b bytes.Buffer
 	gz := gzip.NewWriter(&b)
-	_, err = gz.Write(out)
-	if err != nil {
+	if _, err := gz.Write(data); err != nil {
 		return nil, "", err
 	}
 	gz.Close()
-	// return the hash and the gzipped output
 	return b.Bytes(), hash, nil
 }
+
+// runNode writes docs to DOCS_PATH, runs gen_index.js, and returns the contents of INDEX_PATH.
+func runNode(ctx context.Context, docs *[]html.Doc) ([]byte, error) {
+	// write the search docs file
+	if err := os.MkdirAll(filepath.Dir(DOCS_PATH), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating search docs directory %s: %w", DOCS_PATH, err)
+	}
+	if err := files.SaveJSON(DOCS_PATH, &docs, 0o644); err != nil {
+		return nil, fmt.Errorf("error writing search docs file %s: %w", DOCS_PATH, err)
+	}
+	// run the lunrjs script
+	cmd := exec.CommandContext(ctx, "node", SCRIPT_PATH, "-q")
+	cout, err := system.RunCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running lunrjs script %s: %w\n%s", SCRIPT_PATH, err, cout)
+	}
+	return os.ReadFile(INDEX_PATH)
+}
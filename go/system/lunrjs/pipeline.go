@@ -0,0 +1,244 @@
+package lunrjs
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Ports of the lunr.js 2.x tokenizer and default pipeline (trimmer, stop word
+// filter, stemmer). They follow the JS source closely, including its quirks,
+// e.g. tokens trimmed down to "" are kept, so the index matches lunr.js's.
+
+// stopWords is lunr.stopWordFilter's list.
+var stopWords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(`a able about across after all almost also am among an and any are as at
+		be because been but by can cannot could dear did do does either else ever every for from get got had
+		has have he her hers him his how however i if in into is it its just least let like likely may me
+		might most must my neither no nor not of off often on only or other our own rather said say says she
+		should since so some than that the their them then there these they this tis to too twas us wants
+		was we were what when where which while who whom why will with would yet you your`) {
+		m[w] = true
+	}
+	return m
+}()
+
+// isSeparator matches lunr.tokenizer.separator, /[\s\-]+/, one char at a time.
+func isSeparator(r rune) bool {
+	switch r {
+	case '-', '\t', '\n', '\v', '\f', '\r', ' ', 0xa0, 0x1680, 0x2028, 0x2029, 0x202f, 0x205f, 0x3000, 0xfeff:
+		return true
+	}
+	return r >= 0x2000 && r <= 0x200a
+}
+
+// tokenize is lunr.tokenizer for a string.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(jsLower(s), isSeparator)
+}
+
+// runPipeline applies trimmer, stopWordFilter, and stemmer in that order.
+func runPipeline(tokens []string) []string {
+	out := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		t = trim(t)
+		if stopWords[t] {
+			continue
+		}
+		out = append(out, stem(t))
+	}
+	return out
+}
+
+// isWord matches JS's \w, which is ASCII only.
+func isWord(r rune) bool {
+	return r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// trim is lunr.trimmer, strips non word chars from both ends.
+func trim(s string) string {
+	notWord := func(r rune) bool { return !isWord(r) }
+	return strings.TrimRightFunc(strings.TrimLeftFunc(s, notWord), notWord)
+}
+
+// jsLower is String.prototype.toLowerCase, which unlike strings.ToLower
+// applies the unconditional and final sigma special casings.
+func jsLower(s string) string {
+	if !strings.ContainsAny(s, "İΣ") {
+		return strings.ToLower(s)
+	}
+	rs := []rune(s)
+	cased := func(r rune) bool { return unicode.IsUpper(r) || unicode.IsLower(r) || unicode.IsTitle(r) }
+	ignorable := func(r rune) bool {
+		return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Lm, unicode.Sk) || strings.ContainsRune("'.:·’", r)
+	}
+	var b strings.Builder
+	for i, r := range rs {
+		switch r {
+		case 0x130: // İ
+			b.WriteString("i\u0307")
+		case 0x3a3: // Σ, final if after a cased letter and not before one
+			before, after := false, false
+			for j := i - 1; j >= 0; j-- {
+				if !ignorable(rs[j]) {
+					before = cased(rs[j])
+					break
+				}
+			}
+			for j := i + 1; j < len(rs); j++ {
+				if !ignorable(rs[j]) {
+					after = cased(rs[j])
+					break
+				}
+			}
+			if before && !after {
+				b.WriteRune('ς')
+			} else {
+				b.WriteRune('σ')
+			}
+		default:
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// Porter stemmer, as in lunr.stemmer.
+
+var step2list = map[string]string{
+	"ational": "ate", "tional": "tion", "enci": "ence", "anci": "ance", "izer": "ize", "bli": "ble",
+	"alli": "al", "entli": "ent", "eli": "e", "ousli": "ous", "ization": "ize", "ation": "ate",
+	"ator": "ate", "alism": "al", "iveness": "ive", "fulness": "ful", "ousness": "ous", "aliti": "al",
+	"iviti": "ive", "biliti": "ble", "logi": "log",
+}
+
+var step3list = map[string]string{
+	"icate": "ic", "ative": "", "alize": "al", "iciti": "ic", "ical": "ic", "ful": "", "ness": "",
+}
+
+const (
+	stemC = "[^aeiou][^aeiouy]*" // consonant sequence
+	stemV = "[aeiouy][aeiou]*"   // vowel sequence
+)
+
+var (
+	reMgr0 = regexp.MustCompile("^(" + stemC + ")?" + stemV + stemC)                       // [C]VC... is m>0
+	reMeq1 = regexp.MustCompile("^(" + stemC + ")?" + stemV + stemC + "(" + stemV + ")?$") // [C]VC[V] is m=1
+	reMgr1 = regexp.MustCompile("^(" + stemC + ")?" + stemV + stemC + stemV + stemC)       // [C]VCVC... is m>1
+	reSV   = regexp.MustCompile("^(" + stemC + ")?[aeiouy]")                               // vowel in stem
+	reCVC  = regexp.MustCompile("^" + stemC + "[aeiouy][^aeiouwxy]$")                      // re4_1b_2 and re3_5
+	re1a   = regexp.MustCompile(`^(.+?)(ss|i)es$`)
+	re21a  = regexp.MustCompile(`^(.+?)([^s])s$`)
+	re1b   = regexp.MustCompile(`^(.+?)eed$`)
+	re21b  = regexp.MustCompile(`^(.+?)(ed|ing)$`)
+	re21b2 = regexp.MustCompile(`(at|bl|iz)$`)
+	re1c   = regexp.MustCompile(`^(.+?[^aeiou])y$`)
+	re2    = regexp.MustCompile(`^(.+?)(ational|tional|enci|anci|izer|bli|alli|entli|eli|ousli|ization|ation|ator|alism|iveness|fulness|ousness|aliti|iviti|biliti|logi)$`)
+	re3    = regexp.MustCompile(`^(.+?)(icate|ative|alize|iciti|ical|ful|ness)$`)
+	re4    = regexp.MustCompile(`^(.+?)(al|ance|ence|er|ic|able|ible|ant|ement|ment|ent|ou|ism|ate|iti|ous|ive|ize)$`)
+	re24   = regexp.MustCompile(`^(.+?)(s|t)(ion)$`)
+	re5    = regexp.MustCompile(`^(.+?)e$`)
+	re51   = regexp.MustCompile(`ll$`)
+)
+
+// dropLast is w.replace(/.$/, ""). The last char is in the BMP wherever it's
+// used, so one JS char is one rune.
+func dropLast(w string) string {
+	rs := []rune(w)
+	return string(rs[:len(rs)-1])
+}
+
+// endsInDouble is /([^aeiouylsz])\1$/.test(w). JS compares UTF-16 units, so
+// a doubled astral char never matches.
+func endsInDouble(w string) bool {
+	rs := []rune(w)
+	if len(rs) < 2 {
+		return false
+	}
+	last := rs[len(rs)-1]
+	return last == rs[len(rs)-2] && last < 0x10000 && !strings.ContainsRune("aeiouylsz", last)
+}
+
+func stem(w string) string {
+	if len(utf16.Encode([]rune(w))) < 3 { // JS length
+		return w
+	}
+
+	firstY := w[0] == 'y'
+	if firstY {
+		w = "Y" + w[1:]
+	}
+
+	// Step 1a
+	if re1a.MatchString(w) {
+		w = re1a.ReplaceAllString(w, "$1$2")
+	} else if re21a.MatchString(w) {
+		w = re21a.ReplaceAllString(w, "$1$2")
+	}
+
+	// Step 1b
+	if fp := re1b.FindStringSubmatch(w); fp != nil {
+		if reMgr0.MatchString(fp[1]) {
+			w = dropLast(w)
+		}
+	} else if fp := re21b.FindStringSubmatch(w); fp != nil {
+		if stem := fp[1]; reSV.MatchString(stem) {
+			w = stem
+			if re21b2.MatchString(w) {
+				w += "e"
+			} else if endsInDouble(w) {
+				w = dropLast(w)
+			} else if reCVC.MatchString(w) {
+				w += "e"
+			}
+		}
+	}
+
+	// Step 1c
+	if fp := re1c.FindStringSubmatch(w); fp != nil {
+		w = fp[1] + "i"
+	}
+
+	// Step 2
+	if fp := re2.FindStringSubmatch(w); fp != nil {
+		if reMgr0.MatchString(fp[1]) {
+			w = fp[1] + step2list[fp[2]]
+		}
+	}
+
+	// Step 3
+	if fp := re3.FindStringSubmatch(w); fp != nil {
+		if reMgr0.MatchString(fp[1]) {
+			w = fp[1] + step3list[fp[2]]
+		}
+	}
+
+	// Step 4
+	if fp := re4.FindStringSubmatch(w); fp != nil {
+		if reMgr1.MatchString(fp[1]) {
+			w = fp[1]
+		}
+	} else if fp := re24.FindStringSubmatch(w); fp != nil {
+		if stem := fp[1] + fp[2]; reMgr1.MatchString(stem) {
+			w = stem
+		}
+	}
+
+	// Step 5
+	if fp := re5.FindStringSubmatch(w); fp != nil {
+		stem := fp[1]
+		if reMgr1.MatchString(stem) || (reMeq1.MatchString(stem) && !reCVC.MatchString(stem)) {
+			w = stem
+		}
+	}
+	if re51.MatchString(w) && reMgr1.MatchString(w) {
+		w = dropLast(w)
+	}
+
+	if firstY {
+		w = "y" + w[1:]
+	}
+	return w
+}
@@ -0,0 +1,383 @@
+package lunrjs
+
+import (
+	"html/template"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"intermark/go/html"
+)
+
+const (
+	snippetBefore = 60  // bytes of context kept before the first match
+	snippetLen    = 200 // max bytes of body in a snippet
+)
+
+// Index is the built index kept in memory for server side search. Scores
+// follow lunr.Index.prototype.query, so results match the browser's.
+type Index struct {
+	bd      *builder
+	terms   []string                   // sorted, for wildcard expansion
+	vectors map[string]map[int]float64 // "field/ref" -> termIndex -> score
+	docs    map[string]html.Doc        // ref -> doc, later duplicates win like in the index
+}
+
+// Result is a search hit as served by /api/search.
+type Result struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	URL          string   `json:"url"`
+	Score        float64  `json:"score"`
+	Snippet      string   `json:"snippet"` // escaped HTML, matched words in <mark>
+	Section      string   `json:"section,omitempty"`
+	SectionLabel string   `json:"sectionLabel,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Breadcrumb   []string `json:"breadcrumb,omitempty"` // page title, then headings down to this one
+	Level        int      `json:"level"`
+}
+
+// Filter limits a search to docs in Section, if set, that have all of Tags.
+type Filter struct {
+	Section string
+	Tags    []string
+}
+
+func (f Filter) match(d html.Doc) bool {
+	if f.Section != "" && d.Section != f.Section {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(d.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Facet is a section or tag and how many matches it has.
+type Facet struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Facets counts the matches of a search before its filter is applied, so
+// readers can see what other sections and tags have.
+type Facets struct {
+	Sections []Facet `json:"sections"`
+	Tags     []Facet `json:"tags"`
+}
+
+// NewIndex builds the index for docs.
+func NewIndex(docs []html.Doc) *Index {
+	bd := newBuilder(docs)
+	idx := &Index{
+		bd:      bd,
+		terms:   make([]string, 0, len(bd.inverted)),
+		vectors: make(map[string]map[int]float64, len(bd.fieldRefs)),
+		docs:    make(map[string]html.Doc, len(docs)),
+	}
+	for term := range bd.inverted {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+	for i, vec := range bd.fieldVectors() {
+		m := make(map[int]float64, len(vec)/2)
+		for j := 0; j < len(vec); j += 2 {
+			m[int(vec[j])] = vec[j+1]
+		}
+		idx.vectors[bd.fieldRefs[i]] = m
+	}
+	for _, d := range docs {
+		idx.docs[d.ID] = d
+	}
+	return idx
+}
+
+// JSON returns the index as gen_index.js writes it.
+func (idx *Index) JSON() []byte {
+	return idx.bd.serialize()
+}
+
+type clause struct {
+	terms    []string
+	fields   []string
+	required bool
+	excluded bool
+}
+
+// parseQuery supports the common parts of lunr's query syntax: "+term"
+// (required), "-term" (excluded), "title:term", and "*" wildcards.
+func parseQuery(q string) []clause {
+	var clauses []clause
+	for _, word := range strings.Fields(q) {
+		c := clause{fields: fieldNames}
+		switch word[0] {
+		case '+':
+			c.required, word = true, word[1:]
+		case '-':
+			c.excluded, word = true, word[1:]
+		}
+		if field, rest, ok := strings.Cut(word, ":"); ok && fieldBoosts[field] != 0 {
+			c.fields, word = []string{field}, rest
+		}
+		for i, part := range strings.FieldsFunc(word, isSeparator) {
+			if i > 0 {
+				// like lunr's lexer, a hyphen starts a new optional clause
+				c = clause{fields: c.fields}
+			}
+			if strings.Contains(part, "*") {
+				c.terms = []string{jsLower(part)} // wildcards skip the pipeline
+			} else {
+				c.terms = runPipeline(tokenize(part))
+			}
+			clauses = append(clauses, c)
+		}
+	}
+	return clauses
+}
+
+// expand returns the index terms a query term matches.
+func (idx *Index) expand(term string) []string {
+	if !strings.Contains(term, "*") {
+		if _, ok := idx.bd.inverted[term]; ok && term != "" {
+			return []string{term}
+		}
+		return nil
+	}
+	prefix, _, _ := strings.Cut(term, "*")
+	var out []string
+	for i := sort.SearchStrings(idx.terms, prefix); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], prefix); i++ {
+		if globMatch(term, idx.terms[i]) {
+			out = append(out, idx.terms[i])
+		}
+	}
+	return out
+}
+
+// Search returns the best limit results for q that pass f, the total number
+// that do, and facets for all matches.
+func (idx *Index) Search(q string, limit int, f Filter) ([]Result, int, Facets) {
+	queryVectors := map[string]map[int]float64{} // field -> termIndex -> boost
+	matching := []string{}                       // "field/ref", in the order lunr finds them
+	seenField := map[string]bool{}
+	matchedTerms := map[string]map[string]bool{} // ref -> terms, for snippets
+	var required []map[string]bool
+	excluded := map[string]bool{}
+
+	for _, c := range parseQuery(q) {
+		clauseDocs := map[string]bool{}
+		for _, term := range c.terms {
+			for _, t := range idx.expand(term) {
+				p := idx.bd.inverted[t]
+				for _, field := range c.fields {
+					for _, ref := range p.refs[field] {
+						if c.excluded {
+							excluded[ref] = true
+							continue
+						}
+						clauseDocs[ref] = true
+						fieldRef := field + "/" + ref
+						if !seenField[fieldRef] {
+							seenField[fieldRef] = true
+							matching = append(matching, fieldRef)
+						}
+						if matchedTerms[ref] == nil {
+							matchedTerms[ref] = map[string]bool{}
+						}
+						matchedTerms[ref][t] = true
+					}
+					if !c.excluded {
+						if queryVectors[field] == nil {
+							queryVectors[field] = map[int]float64{}
+						}
+						queryVectors[field][p.index]++
+					}
+				}
+			}
+		}
+		if c.required {
+			required = append(required, clauseDocs)
+		}
+	}
+
+	// score, summing each doc's fields
+	scores := map[string]float64{}
+	var refs []string
+	for _, fieldRef := range matching {
+		field, ref := fieldOf(fieldRef), fieldRef[len(fieldOf(fieldRef))+1:]
+		if excluded[ref] || !inAll(required, ref) {
+			continue
+		}
+		if _, ok := scores[ref]; !ok {
+			refs = append(refs, ref)
+		}
+		scores[ref] += similarity(queryVectors[field], idx.vectors[fieldRef])
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return scores[refs[i]] > scores[refs[j]] })
+
+	facets := idx.facets(refs)
+	refs = slices.DeleteFunc(refs, func(ref string) bool { return !f.match(idx.docs[ref]) })
+	total := len(refs)
+	if len(refs) > limit {
+		refs = refs[:limit]
+	}
+	results := make([]Result, len(refs))
+	for i, ref := range refs {
+		d := idx.docs[ref]
+		results[i] = Result{
+			ID:           d.ID,
+			Title:        d.Title,
+			URL:          d.URL,
+			Score:        scores[ref],
+			Snippet:      snippet(d.Body, matchedTerms[ref]),
+			Section:      d.Section,
+			SectionLabel: d.SectionLabel,
+			Tags:         d.Tags,
+			Breadcrumb:   d.Breadcrumb,
+			Level:        d.Level,
+		}
+	}
+	return results, total, facets
+}
+
+// facets counts sections and tags of refs, most matches first.
+func (idx *Index) facets(refs []string) Facets {
+	sections, tags := map[string]*Facet{}, map[string]*Facet{}
+	for _, ref := range refs {
+		d := idx.docs[ref]
+		if d.Section != "" {
+			if sections[d.Section] == nil {
+				sections[d.Section] = &Facet{Value: d.Section, Label: d.SectionLabel}
+			}
+			sections[d.Section].Count++
+		}
+		for _, tag := range d.Tags {
+			if tags[tag] == nil {
+				tags[tag] = &Facet{Value: tag}
+			}
+			tags[tag].Count++
+		}
+	}
+	sorted := func(m map[string]*Facet) []Facet {
+		out := make([]Facet, 0, len(m))
+		for _, f := range m {
+			out = append(out, *f)
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Count != out[j].Count {
+				return out[i].Count > out[j].Count
+			}
+			return out[i].Value < out[j].Value
+		})
+		return out
+	}
+	return Facets{Sections: sorted(sections), Tags: sorted(tags)}
+}
+
+// similarity is lunr.Vector.prototype.similarity, called on the query vector.
+func similarity(query, field map[int]float64) float64 {
+	var dot, sumSq float64
+	for i, boost := range query {
+		dot += boost * field[i]
+		sumSq += boost * boost
+	}
+	if sumSq == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(sumSq)
+}
+
+func inAll(sets []map[string]bool, ref string) bool {
+	for _, s := range sets {
+		if !s[ref] {
+			return false
+		}
+	}
+	return true
+}
+
+// globMatch reports whether s matches pattern, where "*" matches any run of chars.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
+
+// snippet returns an excerpt of body around its first word that indexes as one
+// of terms, with every such word wrapped in <mark>.
+func snippet(body string, terms map[string]bool) string {
+	body = strings.Join(strings.Fields(body), " ")
+
+	// find words in body that index as a matched term
+	type span struct{ start, end int }
+	var hits []span
+	start := -1
+	flush := func(end int) {
+		if start >= 0 && terms[stem(trim(jsLower(body[start:end])))] {
+			hits = append(hits, span{start, end})
+		}
+		start = -1
+	}
+	for i, r := range body {
+		if isSeparator(r) {
+			flush(i)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	flush(len(body))
+
+	// window around the first hit, cut at spaces
+	from, to := 0, len(body)
+	if len(hits) > 0 && hits[0].start > snippetBefore {
+		from = hits[0].start - snippetBefore
+		if i := strings.IndexByte(body[from:hits[0].start], ' '); i >= 0 {
+			from += i + 1
+		} else {
+			from = hits[0].start
+		}
+	}
+	if from+snippetLen < len(body) {
+		to = from + snippetLen
+		if i := strings.LastIndexByte(body[from:to], ' '); i > 0 {
+			to = from + i
+		} else {
+			for to > from && (body[to]&0xc0) == 0x80 { // back up to a rune start
+				to--
+			}
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, h := range hits {
+		if h.start < from || h.end > to {
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(body[pos:h.start]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(body[h.start:h.end]) + "</mark>")
+		pos = h.end
+	}
+	b.WriteString(template.HTMLEscapeString(body[pos:to]))
+	if to < len(body) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package lunrjs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"intermark/go/html"
+)
+
+const maxStoreText = 400 // bytes of body text kept per section
+
+type storeDoc struct {
+	Text       string   `json:"text"`
+	Section    string   `json:"section,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Breadcrumb []string `json:"breadcrumb,omitempty"`
+}
+
+// Store returns the store served next to the index, gzipped, and its hash. It
+// has each Doc.ID's section, tags, breadcrumb, and the start of its body with
+// whitespace collapsed, plus section labels. The search modal uses it for snippets and
+// facets, e.g.
+//
+//	{"docs": {"api/auth#tokens": {"text": "...", "section": "api"}}, "sections": {"api": "API"}}
+func Store(docs []html.Doc) ([]byte, string, error) {
+	store := struct {
+		Docs     map[string]storeDoc `json:"docs"`
+		Sections map[string]string   `json:"sections"`
+	}{map[string]storeDoc{}, map[string]string{}}
+	for _, d := range docs {
+		store.Docs[d.ID] = storeDoc{Text: storeText(d.Body), Section: d.Section, Tags: d.Tags, Breadcrumb: d.Breadcrumb}
+		if d.Section != "" {
+			store.Sections[d.Section] = d.SectionLabel
+		}
+	}
+	data, err := json.Marshal(store)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding search store: %w", err)
+	}
+	return pack(data)
+}
+
+// storeText collapses whitespace and cuts text at a space before maxStoreText.
+func storeText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= maxStoreText {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:maxStoreText+1], ' ')
+	if cut <= 0 {
+		// one long word, back up to a rune start
+		for cut = maxStoreText; (text[cut] & 0xc0) == 0x80; cut-- {
+		}
+	}
+	return text[:cut] + "…"
+}
@@ -24,7 +24,7 @@ const (
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run inter.go [setup|clean|build|edit|prod|update_intermark]")
+		fmt.Println("Usage: go run inter.go [setup|clean|build|edit|prod|export [dir] [--gzip]|update_intermark]")
 		os.Exit(1)
 	}
 	cmd := os.Args[1]
@@ -49,6 +49,10 @@ func main() {
 		clean()
 		build()
 		run(binOut())
+	case "export":
+		clean()
+		build()
+		run(binOut(), os.Args[1:]...)
 	case "update_intermark":
 		updateIm()
 	default: